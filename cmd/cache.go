@@ -0,0 +1,45 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	pl "github.com/zph/polylint/pkg"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the result cache",
+	Long: `polylint run caches the findings of each file, keyed by its content and the
+resolved rule set, so unchanged files aren't linted again. Use --no-cache on run
+to bypass it.
+`,
+}
+
+// cacheCleanCmd represents the cache clean command
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove all cached results",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := pl.CacheDirResults()
+		if err == nil {
+			err = pl.CleanResultCache()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error cleaning cache: %v\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Printf("removed %s\n", dir)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheCleanCmd)
+}
@@ -0,0 +1,224 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	pl "github.com/zph/polylint/pkg"
+)
+
+const defaultConfigFile = ".polylint.yaml"
+
+// initCmd represents the init command
+var initCmd = &cobra.Command{
+	Use:   "init [path]",
+	Short: "Create a starter config file",
+	Long: `Create a commented starter config file (default .polylint.yaml)
+with example builtin, js and wasm rules. For example:
+> polylint init --detect
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := defaultConfigFile
+		if len(args) == 1 {
+			path = args[0]
+		}
+		if err := writeStarterConfig(path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		fmt.Printf("wrote %s\n", path)
+	},
+}
+
+var (
+	initForce  bool
+	initDetect bool
+)
+
+// languageExtensions maps file extensions to the language they are detected as
+var languageExtensions = map[string]string{
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".mjs":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".go":    "go",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".c":     "c",
+	".h":     "c",
+	".cpp":   "c++",
+	".cs":    "c#",
+	".php":   "php",
+	".sh":    "shell",
+	".bash":  "shell",
+	".lua":   "lua",
+	".ex":    "elixir",
+	".exs":   "elixir",
+	".scala": "scala",
+}
+
+// defaultIncludePaths is used when languages aren't detected
+const defaultIncludePaths = `\.(py|js|ts|go|rb|sh)$`
+
+var starterConfig = template.Must(template.New("config").Parse(`---
+# Polylint config, see https://github.com/zph/polylint
+# Must be lower than or equal the version of the polylint tool to be valid
+version: {{ .Version }}
+# Includes can be either filesystem local or http(s), pinned by the sha256 of their content
+# includes:
+# - path: https://example.com/shared/polylint.yaml
+#   hash: sha256:<hash of the file content>
+rules:
+{{- if .Languages }}
+# include_paths were detected for: {{ .Languages }}
+{{- end }}
+# Builtin rules are fast golang functions: contains, regexp, replace
+- id: no-todo
+  description: "Don't leave TODOs behind"
+  recommendation: "Open an issue and link it instead."
+  severity: low
+  link: https://example.com/wiki/no-todo
+  # Regexp matched against the path of each file, exclude_paths takes precedence
+  include_paths: '{{ .IncludePaths }}'
+  exclude_paths: null
+  fn:
+    type: builtin
+    # line, file or path
+    scope: line
+    name: contains
+    args:
+    - TODO
+# JS rules embed a function called with (path, index, line) that returns a boolean,
+# or an array of {line, column, message, severity} for file scoped rules
+- id: max-line-length
+  description: "Keep lines readable"
+  recommendation: "Wrap lines longer than 120 characters."
+  severity: low
+  link: https://example.com/wiki/max-line-length
+  include_paths: '{{ .IncludePaths }}'
+  exclude_paths: null
+  fn:
+    type: js
+    scope: line
+    name: fn
+    body: |
+      const fn = (_path, _idx, line) => line.length > 120
+# WASM rules are extism plugins, loaded from a path or url and pinned by their sha256
+# - id: custom-wasm-rule
+#   description: "Custom plugin rule"
+#   recommendation: "See the plugin documentation."
+#   severity: medium
+#   link: https://example.com/wiki/custom-wasm-rule
+#   include_paths: '{{ .IncludePaths }}'
+#   exclude_paths: null
+#   fn:
+#     type: wasm
+#     scope: path
+#     name: path_validator
+#     body: ./plugins/plugin.wasm
+#     metadata:
+#       sha256: <sha256 of plugin.wasm>
+`))
+
+type starterConfigData struct {
+	Version      string
+	IncludePaths string
+	Languages    string
+}
+
+func writeStarterConfig(path string) error {
+	if _, err := os.Stat(path); err == nil && !initForce {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+	}
+
+	data := starterConfigData{
+		Version:      viper.GetString("binary_version"),
+		IncludePaths: defaultIncludePaths,
+	}
+	if initDetect {
+		extensions, languages, err := detectLanguages(".")
+		if err != nil {
+			return err
+		}
+		if len(extensions) > 0 {
+			data.IncludePaths = extensionsRegexp(extensions)
+			data.Languages = strings.Join(languages, ", ")
+		}
+	}
+
+	var b strings.Builder
+	if err := starterConfig.Execute(&b, data); err != nil {
+		return err
+	}
+	if _, err := pl.LoadConfigFileWithSource(b.String(), path); err != nil {
+		return fmt.Errorf("generated config is invalid: %v", err)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// detectLanguages returns the known extensions and languages found below root, most common first
+func detectLanguages(root string) ([]string, []string, error) {
+	counts := make(map[string]int)
+	err := pl.WalkFiles(root, false, func(path string) error {
+		ext := strings.ToLower(filepath.Ext(path))
+		if _, ok := languageExtensions[ext]; ok {
+			counts[ext]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	extensions := make([]string, 0, len(counts))
+	for ext := range counts {
+		extensions = append(extensions, ext)
+	}
+	sort.Slice(extensions, func(i, j int) bool {
+		if counts[extensions[i]] != counts[extensions[j]] {
+			return counts[extensions[i]] > counts[extensions[j]]
+		}
+		return extensions[i] < extensions[j]
+	})
+
+	var languages []string
+	seen := make(map[string]bool)
+	for _, ext := range extensions {
+		if lang := languageExtensions[ext]; !seen[lang] {
+			seen[lang] = true
+			languages = append(languages, lang)
+		}
+	}
+	return extensions, languages, nil
+}
+
+func extensionsRegexp(extensions []string) string {
+	names := make([]string, len(extensions))
+	for idx, ext := range extensions {
+		names[idx] = regexp.QuoteMeta(strings.TrimPrefix(ext, "."))
+	}
+	return fmt.Sprintf(`\.(%s)$`, strings.Join(names, "|"))
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().BoolVar(&initForce, "force", false, "overwrite an existing config file")
+	initCmd.Flags().BoolVar(&initDetect, "detect", false, "set include_paths for the languages found in the current directory")
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	pl "github.com/zph/polylint/pkg"
+)
+
+// hookMarker identifies hooks written by install-hook so they can be replaced without --force
+const hookMarker = "# Installed by polylint install-hook"
+
+// installHookCmd represents the install-hook command
+var installHookCmd = &cobra.Command{
+	Use:   "install-hook [-- run flags]",
+	Short: "Install a git pre-commit hook that lints staged files",
+	Long: `Write a pre-commit hook to the repository's hooks directory that runs
+polylint on the staged files. Arguments after -- are passed to polylint run.
+For example:
+> polylint install-hook -- --fail-on high
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := installHook(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		fmt.Printf("wrote %s\n", path)
+	},
+}
+
+var installHookForce bool
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func preCommitHook(runArgs []string) string {
+	command := []string{"polylint"}
+	if cfgFile != "" {
+		command = append(command, "--config", shellQuote(cfgFile))
+	}
+	command = append(command, "run", "--staged")
+	for _, arg := range runArgs {
+		command = append(command, shellQuote(arg))
+	}
+	return fmt.Sprintf("#!/bin/sh\n%s\nexec %s\n", hookMarker, strings.Join(command, " "))
+}
+
+func installHook(runArgs []string) (string, error) {
+	hooksDir, err := pl.GitHooksDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(hooksDir, "pre-commit")
+	if existing, err := os.ReadFile(path); err == nil && !installHookForce && !strings.Contains(string(existing), hookMarker) {
+		return "", fmt.Errorf("%s already exists, use --force to overwrite it", path)
+	}
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(preCommitHook(runArgs)), 0755); err != nil {
+		return "", err
+	}
+	// WriteFile keeps the mode of an existing file, make sure the hook is executable
+	return path, os.Chmod(path, 0755)
+}
+
+func init() {
+	rootCmd.AddCommand(installHookCmd)
+
+	installHookCmd.Flags().BoolVar(&installHookForce, "force", false, "overwrite an existing pre-commit hook")
+}
@@ -0,0 +1,48 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	pl "github.com/zph/polylint/pkg"
+)
+
+// lspCmd represents the lsp command
+var lspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "Run a language server over stdio",
+	Long: `Run a Language Server Protocol server over stdin and stdout that publishes
+findings as diagnostics while files are edited, with quick fixes that add
+polylint disable comments. Rules are reloaded when the config file changes.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configName := defaultConfigFile
+		if viper.ConfigFileUsed() != "" {
+			configName = filepath.Base(viper.ConfigFileUsed())
+		}
+		server := pl.NewLSPServer(os.Stdin, os.Stdout, configName, func() (pl.ConfigFile, error) {
+			// The config may have been created after the server started
+			if viper.ConfigFileUsed() == "" {
+				if err := viper.ReadInConfig(); err != nil {
+					return pl.ConfigFile{}, err
+				}
+			}
+			return loadConfig()
+		})
+		if err := server.Serve(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lspCmd)
+}
@@ -4,6 +4,7 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -68,11 +69,13 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	if err := viper.ReadInConfig(); err != nil {
-		// Error means that it's a non-standard configuration file but that's ok
-		if err != viper.UnsupportedConfigError("polylint") {
+		// Error means that it's a non-standard configuration file but that's ok.
+		// A missing config is reported by the commands that need one, `init` creates it.
+		var notFound viper.ConfigFileNotFoundError
+		if err != viper.UnsupportedConfigError("polylint") && !errors.As(err, &notFound) {
 			fmt.Fprintf(os.Stderr, "Error reading config file: %s\nError: %e", viper.ConfigFileUsed(), err)
 		}
 	} else {
-		fmt.Printf("Using config file: %s\n", viper.ConfigFileUsed())
+		fmt.Fprintf(os.Stderr, "Using config file: %s\n", viper.ConfigFileUsed())
 	}
 }
@@ -5,11 +5,12 @@ package cmd
 
 import (
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 
-	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	pl "github.com/zph/polylint/pkg"
@@ -22,101 +23,395 @@ var runCmd = &cobra.Command{
 	Long: `Run linter against files or root folder(s)
 and usage of using your command. For example:
 > polylint --config .polylint run src/ lib/
+
+With --changed-since or --staged only the files changed in git are linted,
+limited to the given files or folders when any are passed. With --staged the
+staged content is linted rather than the working tree copy:
+> polylint run --changed-since origin/main --diff-lines-only
+
+With --files-from-stdin the files to lint are read from stdin, one per line
+or NUL separated:
+> git diff --cached --name-only -z | polylint run --files-from-stdin
+
+With --stdin the content of a single file is read from stdin and linted as
+if it were the file at --stdin-filename, for editors linting unsaved buffers:
+> polylint run --stdin --stdin-filename src/app.py < buffer
+
+With --watch polylint keeps running after the first run and re-lints files as
+they change, reloading the rules when the config or its includes change:
+> polylint run --watch src/
+
+Exit codes:
+  0 no findings at or above the --fail-on severity
+  1 findings at or above the --fail-on severity
+  2 configuration or runtime errors
 `,
-	Args: cobra.MinimumNArgs(1),
-	Run:  RunCmd,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if runChangedSince != "" || runStaged || runFilesFromStdin || runStdin {
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
+	Run: RunCmd,
+}
+
+const (
+	// exitClean means no findings at or above the --fail-on threshold
+	exitClean = 0
+	// exitFindings means at least one finding at or above the --fail-on threshold
+	exitFindings = 1
+	// exitError means the run failed due to configuration or runtime errors
+	exitError = 2
+)
+
+const failOnNever = "never"
+
+var (
+	runFormat   string
+	runOutput   string
+	runJobs     int
+	runNoIgnore bool
+	runFailOn   string
+	runFix      bool
+	runFixDry   bool
+
+	runBaseline      string
+	runWriteBaseline string
+
+	runChangedSince  string
+	runStaged        bool
+	runDiffLinesOnly bool
+
+	runFilesFromStdin bool
+	runStdin          bool
+	runStdinFilename  string
+
+	runWatch   bool
+	runNoCache bool
+
+	runReportUnusedIgnores bool
+)
+
+// failOnThreshold parses --fail-on, returning false when findings should never fail the run
+func failOnThreshold(s string) (pl.SeverityLevel, bool, error) {
+	if s == failOnNever {
+		return 0, false, nil
+	}
+	threshold, err := pl.ParseSeverityLevel(s)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid --fail-on value %q, expected one of low, medium, high, never", s)
+	}
+	return threshold, true, nil
 }
 
 func Run(cmd *cobra.Command, args []string) (int, []error) {
-	var exitCode int
-	exitCode = 0
 	var errs []error
-	var results []pl.FileReport
-	for _, root := range args {
-		configRaw, err := os.ReadFile(viper.ConfigFileUsed())
+	threshold, failOnFindings, err := failOnThreshold(runFailOn)
+	if err != nil {
+		return exitError, []error{err}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("error loading config:\n%v\n", err)
+		return exitError, []error{err}
+	}
 
+	var results []pl.FileReport
+	if runStdin {
+		result, err := lintStdin(cfg, args)
+		if err != nil {
+			return exitError, []error{err}
+		}
+		results = []pl.FileReport{result}
+	} else {
+		paths, walkErrs, err := collectPaths(args)
 		if err != nil {
-			panic(err)
+			return exitError, []error{err}
+		}
+		errs = append(errs, walkErrs...)
+		var cache *pl.ResultCache
+		if !runNoCache {
+			if cache, err = pl.NewResultCache(cfg); err != nil {
+				return exitError, []error{err}
+			}
+		}
+		var processErrs []error
+		if runStaged {
+			results, processErrs = pl.ProcessStagedPaths(paths, cfg, runJobs, cache)
+		} else {
+			results, processErrs = pl.ProcessPathsWithCache(paths, cfg, runJobs, cache)
 		}
-		cfg, err := pl.LoadConfigFile(string(configRaw))
+		errs = append(errs, processErrs...)
+	}
 
+	if runReportUnusedIgnores {
+		results = pl.ReportUnusedIgnores(results)
+	}
+
+	if runDiffLinesOnly {
+		changed, err := pl.GitChangedLines(runChangedSince, runStaged)
 		if err != nil {
-			fmt.Printf("error loading config: %v\n", err)
-			return exitCode, []error{err}
+			return exitError, []error{err}
 		}
+		results = pl.FilterChangedLines(results, changed)
+	}
 
-		err = filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
-			if err != nil {
-				fmt.Printf("error accessing path %q: %v\n", path, err)
-				return err
-			}
+	if runFix || runFixDry {
+		results, err = fixResults(results, runFixDry)
+		errs = append(errs, err)
+	}
+
+	var stale []pl.BaselineEntry
+	results, stale, err = applyBaseline(results)
+	if err != nil {
+		errs = append(errs, err)
+	}
 
-			// Causes 4x slowdown in benchmarks on project with large node_modules folder
-			// if we use IsRegular() instead of isDir()
-			// Regular mode = non-dir, non-symlink etcs
-			// TODO(zph) investigate this issue and find a better solution
-			if !info.IsDir() {
-				content, err := os.ReadFile(path)
+	if err := writeReports(results, stale); err != nil {
+		errs = append(errs, err)
+	}
 
-				if err != nil {
-					fmt.Printf("error reading file %q: %v\n", path, err)
-					return err
-				}
+	if runWatch {
+		if err := watchRoots(cfg, args); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-				result, err2 := pl.ProcessFile(string(content), path, cfg)
-				if err2 != nil {
-					return fmt.Errorf("error processing file %q: %v", path, err2)
-				}
+	nonNilErrors := make([]error, 0)
+	for _, e := range errs {
+		if e != nil {
+			nonNilErrors = append(nonNilErrors, e)
+		}
+	}
+	if len(nonNilErrors) > 0 {
+		return exitError, nonNilErrors
+	}
 
-				results = append(results, result)
+	exitCode := exitClean
+	if failOnFindings {
+		for _, result := range results {
+			if len(result.FindingsAtOrAbove(threshold)) > 0 {
+				exitCode = exitFindings
+				break
 			}
+		}
+	}
+	return exitCode, nonNilErrors
+}
 
+// collectPaths lists the files to lint from the git flags, stdin or by walking the roots
+func collectPaths(roots []string) ([]string, []error, error) {
+	if runChangedSince != "" || runStaged {
+		paths, err := changedPaths(roots)
+		return paths, nil, err
+	}
+	if runDiffLinesOnly {
+		return nil, nil, fmt.Errorf("--diff-lines-only requires --changed-since or --staged")
+	}
+
+	var paths []string
+	var errs []error
+	if runFilesFromStdin {
+		stdinPaths, err := pl.ReadPathList(os.Stdin)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading files from stdin: %v", err)
+		}
+		paths = append(paths, stdinPaths...)
+	}
+	for _, root := range roots {
+		err := pl.WalkFiles(root, runNoIgnore, func(path string) error {
+			paths = append(paths, path)
 			return nil
 		})
+		if err != nil {
+			fmt.Printf("error walking path %q: %v\n", root, err)
+		}
 		errs = append(errs, err)
 	}
+	return paths, errs, nil
+}
+
+// lintStdin lints the content of stdin as if it were the file at --stdin-filename, so that
+// include_paths, exclude_paths and path scoped rules apply to the virtual path
+func lintStdin(cfg pl.ConfigFile, args []string) (pl.FileReport, error) {
+	if runStdinFilename == "" {
+		return pl.FileReport{}, fmt.Errorf("--stdin requires --stdin-filename")
+	}
+	if len(args) > 0 {
+		return pl.FileReport{}, fmt.Errorf("--stdin doesn't accept files or folders, got %v", args)
+	}
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return pl.FileReport{}, fmt.Errorf("error reading stdin: %v", err)
+	}
+	result, err := pl.ProcessFile(string(content), runStdinFilename, cfg)
+	if err != nil {
+		return pl.FileReport{}, fmt.Errorf("error processing file %q: %v", runStdinFilename, err)
+	}
+	return result, nil
+}
+
+// changedPaths lists the files changed in git, keeping those below the given roots if any
+func changedPaths(roots []string) ([]string, error) {
+	changed, err := pl.GitChangedFiles(runChangedSince, runStaged)
+	if err != nil {
+		return nil, err
+	}
+	if !runNoIgnore {
+		if changed, err = pl.FilterIgnoredPaths(changed); err != nil {
+			return nil, err
+		}
+	}
+	if len(roots) == 0 {
+		return changed, nil
+	}
+
+	var paths []string
+	for _, path := range changed {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, root := range roots {
+			absRoot, err := filepath.Abs(root)
+			if err != nil {
+				return nil, err
+			}
+			if rel, err := filepath.Rel(absRoot, absPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				paths = append(paths, path)
+				break
+			}
+		}
+	}
+	return paths, nil
+}
+
+// fixResults applies the fixes found in each report. With dryRun the changes are printed as a
+// unified diff, otherwise files are rewritten and the findings that were fixed are dropped.
+func fixResults(results []pl.FileReport, dryRun bool) ([]pl.FileReport, error) {
+	for idx, result := range results {
+		hasFix := false
+		for _, finding := range result.Findings {
+			if finding.Fix != nil {
+				hasFix = true
+				break
+			}
+		}
+		if !hasFix {
+			continue
+		}
+
+		content, err := os.ReadFile(result.Path)
+		if err != nil {
+			return results, fmt.Errorf("error reading file %q: %v", result.Path, err)
+		}
+		fixed := pl.ApplyFixes(result.Path, string(content), result.Findings)
+		if len(fixed.Conflicts) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: skipped %d overlapping fix(es), run --fix again to apply them\n", result.Path, len(fixed.Conflicts))
+		}
+		if !fixed.Changed() {
+			continue
+		}
+		if dryRun {
+			fmt.Fprint(humanOutput(), pl.UnifiedDiff(result.Path, fixed.Before, fixed.After))
+			continue
+		}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"File", "#", "Scope", "Rule Id", "Recommendation", "Link"})
-
-	summary := table.NewWriter()
-	summary.SetOutputMirror(os.Stdout)
-	summary.AppendHeader(table.Row{"File", "Violations"})
-	summary.SortBy([]table.SortBy{
-		{Name: "Violations", Mode: table.Dsc},
-	})
-	for _, result := range results {
-		if len(result.Findings) > 0 {
-			summary.AppendRow([]interface{}{result.Path, len(result.Findings)})
-			for idx, finding := range result.Findings {
-				var scope string
-				if finding.Rule.Scope == "file" || finding.Rule.Scope == "path" {
-					scope = fmt.Sprintf("%s", finding.Rule.Scope)
-				} else {
-					scope = fmt.Sprintf("%s %3d", finding.Rule.Scope, finding.LineNo)
-				}
-				t.AppendRow([]interface{}{
-					result.Path, idx + 1, scope, finding.RuleId, finding.Rule.Recommendation, finding.Rule.Link,
-				})
-				exitCode += 1
+		info, err := os.Stat(result.Path)
+		if err != nil {
+			return results, err
+		}
+		if err := os.WriteFile(result.Path, []byte(fixed.After), info.Mode()); err != nil {
+			return results, fmt.Errorf("error writing fixes to %q: %v", result.Path, err)
+		}
+
+		applied := make(map[*pl.Edit]bool)
+		for _, finding := range fixed.Applied {
+			applied[finding.Fix] = true
+		}
+		var remaining []pl.Finding
+		for _, finding := range result.Findings {
+			if finding.Fix == nil || !applied[finding.Fix] {
+				remaining = append(remaining, finding)
 			}
 		}
+		results[idx].Findings = remaining
 	}
-	summary.Render()
-	t.Render()
+	return results, nil
+}
 
-	if exitCode > 255 {
-		exitCode = 255
+// applyBaseline writes the current findings to --write-baseline and drops findings recorded
+// in the baseline, returning baseline entries that no longer match anything
+func applyBaseline(results []pl.FileReport) ([]pl.FileReport, []pl.BaselineEntry, error) {
+	if runWriteBaseline != "" {
+		baseline := pl.NewBaseline(results)
+		if err := baseline.Write(runWriteBaseline); err != nil {
+			return results, nil, fmt.Errorf("error writing baseline %q: %v", runWriteBaseline, err)
+		}
+		fmt.Fprintf(os.Stderr, "wrote %d baseline entries to %s\n", len(baseline.Entries), runWriteBaseline)
+		filtered, _ := baseline.Filter(results)
+		return filtered, nil, nil
+	}
+	if runBaseline == "" {
+		return results, nil, nil
 	}
+	baseline, err := pl.LoadBaseline(runBaseline)
+	if err != nil {
+		return results, nil, err
+	}
+	filtered, stale := baseline.Filter(results)
+	return filtered, stale, nil
+}
 
-	nonNilErrors := make([]error, 0)
-	for _, e := range errs {
-		if e != nil {
-			nonNilErrors = append(nonNilErrors, e)
+// loadConfig reads and builds the config file selected by --config or discovered by viper
+func loadConfig() (pl.ConfigFile, error) {
+	configRaw, err := os.ReadFile(viper.ConfigFileUsed())
+	if err != nil {
+		return pl.ConfigFile{}, fmt.Errorf("error reading config file %q: %v", viper.ConfigFileUsed(), err)
+	}
+	return pl.LoadConfigFileWithSource(string(configRaw), viper.ConfigFileUsed())
+}
+
+// humanOutput is where the summary and --fix-dry-run diffs are written: stdout, or stderr when
+// stdout is already carrying a machine readable report
+func humanOutput() io.Writer {
+	if (runOutput == "" || runOutput == "-") && runFormat != pl.TableFormat {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// writeReports renders results in the selected --format to --output and the human summary
+// to humanOutput
+func writeReports(results []pl.FileReport, stale []pl.BaselineEntry) error {
+	reporter, err := pl.NewReporter(runFormat)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if runOutput != "" && runOutput != "-" {
+		file, err := os.Create(runOutput)
+		if err != nil {
+			return fmt.Errorf("error creating output file %q: %v", runOutput, err)
 		}
+		defer file.Close()
+		out = file
 	}
-	return exitCode, nonNilErrors
+
+	summaryOut := humanOutput()
+
+	if err := (pl.SummaryReporter{}).Report(summaryOut, results); err != nil {
+		return err
+	}
+	if err := (pl.StaleBaselineReporter{}).Report(summaryOut, stale); err != nil {
+		return err
+	}
+	if err := (pl.WarningsReporter{}).Report(summaryOut, results); err != nil {
+		return err
+	}
+	return reporter.Report(out, results)
 }
 
 func RunCmd(cmd *cobra.Command, args []string) {
@@ -129,4 +424,37 @@ func RunCmd(cmd *cobra.Command, args []string) {
 
 func init() {
 	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringVar(&runFormat, "format", pl.TableFormat, fmt.Sprintf("output format, one of %v", pl.ReporterFormats()))
+	runCmd.Flags().IntVarP(&runJobs, "jobs", "j", runtime.GOMAXPROCS(0), "number of files to lint in parallel")
+	runCmd.Flags().BoolVar(&runNoIgnore, "no-ignore", false, "don't skip files matched by .gitignore, core.excludesFile, .git/info/exclude or .polylintignore")
+	runCmd.Flags().StringVar(&runFailOn, "fail-on", "low", "minimum severity that causes a non-zero exit code, one of low, medium, high, never")
+	runCmd.Flags().BoolVar(&runFix, "fix", false, "apply fixes offered by rules and rewrite files in place")
+	runCmd.Flags().BoolVar(&runFixDry, "fix-dry-run", false, "print the fixes offered by rules as a unified diff without writing files")
+	runCmd.MarkFlagsMutuallyExclusive("fix", "fix-dry-run")
+	runCmd.Flags().StringVar(&runBaseline, "baseline", "", "only report findings that aren't recorded in this baseline file")
+	runCmd.Flags().StringVar(&runWriteBaseline, "write-baseline", "", "record all current findings to this baseline file")
+	runCmd.MarkFlagsMutuallyExclusive("baseline", "write-baseline")
+	runCmd.Flags().StringVar(&runChangedSince, "changed-since", "", "only lint files changed in git since this ref, including uncommitted and untracked files")
+	runCmd.Flags().BoolVar(&runStaged, "staged", false, "only lint files staged in git, reading their staged content")
+	runCmd.MarkFlagsMutuallyExclusive("changed-since", "staged")
+	// Fixes are written to the working tree, which may not match the staged content
+	runCmd.MarkFlagsMutuallyExclusive("staged", "fix")
+	runCmd.MarkFlagsMutuallyExclusive("staged", "fix-dry-run")
+	runCmd.Flags().BoolVar(&runFilesFromStdin, "files-from-stdin", false, "lint the files listed on stdin, one per line or NUL separated")
+	runCmd.MarkFlagsMutuallyExclusive("files-from-stdin", "changed-since")
+	runCmd.MarkFlagsMutuallyExclusive("files-from-stdin", "staged")
+	runCmd.Flags().BoolVar(&runStdin, "stdin", false, "lint the content of stdin as the file named by --stdin-filename")
+	runCmd.Flags().StringVar(&runStdinFilename, "stdin-filename", "", "virtual path of the content read with --stdin, used to match include_paths, exclude_paths and path rules")
+	runCmd.Flags().BoolVar(&runDiffLinesOnly, "diff-lines-only", false, "only report line scoped findings on lines added or modified in the diff")
+	runCmd.Flags().BoolVar(&runReportUnusedIgnores, "report-unused-ignores", false, "report ignore directives that don't suppress any finding")
+	runCmd.Flags().BoolVar(&runNoCache, "no-cache", false, "lint every file instead of reusing cached results for unchanged files")
+	runCmd.Flags().BoolVar(&runWatch, "watch", false, "keep running and re-lint files as they change")
+	runCmd.Flags().StringVarP(&runOutput, "output", "o", "", "write the report to this file instead of stdout")
+	for _, flag := range []string{"files-from-stdin", "changed-since", "staged", "diff-lines-only", "fix", "fix-dry-run", "watch"} {
+		runCmd.MarkFlagsMutuallyExclusive("stdin", flag)
+	}
+	for _, flag := range []string{"files-from-stdin", "changed-since", "staged", "fix", "fix-dry-run", "write-baseline"} {
+		runCmd.MarkFlagsMutuallyExclusive("watch", flag)
+	}
 }
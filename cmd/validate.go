@@ -4,11 +4,11 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	pkg "github.com/zph/polylint/pkg"
 )
 
@@ -18,22 +18,47 @@ var validateCmd = &cobra.Command{
 	Short: "Validation configuration files",
 	Run: func(cmd *cobra.Command, args []string) {
 		// TODO: standardize this to also do symlinks
-		content, err := os.ReadFile(viper.ConfigFileUsed())
-		if err != nil {
-			panic(err)
-		}
-		cfg, err := pkg.LoadConfigFile(string(content))
-		if err != nil {
-			panic(err)
-		}
-		err = pkg.ValidateConfigFile(cfg)
-		if err != nil {
-			panic(err)
+		errs := validate()
+		if len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			fmt.Fprintf(os.Stderr, "validation failed with %d error(s)\n", len(errs))
+			os.Exit(exitError)
 		}
 		fmt.Println("validation success")
 	},
 }
 
+// validate loads the config and checks it, returning every problem found
+func validate() []error {
+	var errs []error
+	cfg, err := loadConfig()
+	errs = append(errs, flattenConfigErrors(err)...)
+	// A config that failed to read has no rules worth validating
+	var configErrs pkg.ConfigErrors
+	if err != nil && !errors.As(err, &configErrs) {
+		return errs
+	}
+	errs = append(errs, flattenConfigErrors(pkg.ValidateConfigFile(cfg))...)
+	return errs
+}
+
+func flattenConfigErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	var configErrs pkg.ConfigErrors
+	if errors.As(err, &configErrs) {
+		errs := make([]error, len(configErrs))
+		for idx, e := range configErrs {
+			errs[idx] = e
+		}
+		return errs
+	}
+	return []error{err}
+}
+
 func init() {
 	rootCmd.AddCommand(validateCmd)
 }
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	pl "github.com/zph/polylint/pkg"
+)
+
+// watchDebounce batches the burst of events editors produce for a single save, it is the
+// longest a change waits before being linted
+const watchDebounce = 100 * time.Millisecond
+
+// watcher re-lints files below the run roots as they change, keeping the rules and their
+// goja VMs and extism plugins loaded between runs
+type watcher struct {
+	fs    *fsnotify.Watcher
+	cfg   pl.ConfigFile
+	roots []string
+	// dirRoots are absolute directories whose files are linted, files are absolute explicit roots
+	dirRoots []string
+	files    map[string]bool
+	// configSources are the absolute paths of the config and its local includes
+	configSources map[string]bool
+	// watchedDirs avoids adding directories to the fsnotify watcher twice
+	watchedDirs map[string]bool
+}
+
+// watchRoots blocks re-linting changed files until the watcher fails
+func watchRoots(cfg pl.ConfigFile, roots []string) error {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error starting watcher: %v", err)
+	}
+	defer fsWatcher.Close()
+
+	w := &watcher{fs: fsWatcher, roots: roots, files: make(map[string]bool), watchedDirs: make(map[string]bool)}
+	for _, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			w.files[absRoot] = true
+			if err := w.addDir(filepath.Dir(root)); err != nil {
+				return err
+			}
+			continue
+		}
+		w.dirRoots = append(w.dirRoots, absRoot)
+		if err := pl.WalkDirs(root, runNoIgnore, w.addDir); err != nil {
+			return err
+		}
+	}
+	if err := w.setConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "watching %d director(ies) for changes\n", len(w.watchedDirs))
+
+	pending := make(map[string]fsnotify.Op)
+	var flush <-chan time.Time
+	for {
+		select {
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			pending[event.Name] |= event.Op
+			// The first pending event sets the deadline and later ones don't push it back, so a
+			// long stream of events, like a checkout, still re-lints as it goes
+			if flush == nil {
+				flush = time.After(watchDebounce)
+			}
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "watch error: %v\n", err)
+		case <-flush:
+			flush = nil
+			w.relint(pending)
+			pending = make(map[string]fsnotify.Op)
+		}
+	}
+}
+
+func (w *watcher) addDir(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if w.watchedDirs[absDir] {
+		return nil
+	}
+	if err := w.fs.Add(dir); err != nil {
+		return fmt.Errorf("error watching %q: %v", dir, err)
+	}
+	w.watchedDirs[absDir] = true
+	return nil
+}
+
+// setConfig swaps in the rules and watches the directories of the config and its includes
+func (w *watcher) setConfig(cfg pl.ConfigFile) error {
+	w.cfg = cfg
+	w.configSources = make(map[string]bool)
+	for _, source := range cfg.Sources {
+		w.configSources[source] = true
+		if err := w.addDir(filepath.Dir(source)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lintable reports whether a changed path is one of the explicit file roots or a path below a
+// directory root that isn't ignored
+func (w *watcher) lintable(path string, isDir bool) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if w.files[absPath] {
+		return true
+	}
+	for _, root := range w.dirRoots {
+		if strings.HasPrefix(absPath, root+string(filepath.Separator)) {
+			if runNoIgnore {
+				return true
+			}
+			ignored, err := pl.IsIgnored(path, isDir)
+			return err == nil && !ignored
+		}
+	}
+	return false
+}
+
+func (w *watcher) relint(pending map[string]fsnotify.Op) {
+	changed := make([]string, 0, len(pending))
+	for path := range pending {
+		changed = append(changed, path)
+	}
+	sort.Strings(changed)
+
+	for _, path := range changed {
+		if absPath, err := filepath.Abs(path); err == nil && w.configSources[absPath] {
+			w.reload()
+			return
+		}
+	}
+
+	var paths []string
+	for _, path := range changed {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			if w.lintable(path, false) {
+				fmt.Fprintf(os.Stderr, "%s removed\n", path)
+			}
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading %q: %v\n", path, err)
+			continue
+		}
+		if info.IsDir() {
+			// New directories are watched and their files linted, like a fresh walk would
+			if pending[path].Has(fsnotify.Create) && w.lintable(path, true) {
+				if err := pl.WalkDirs(path, runNoIgnore, w.addDir); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				pl.WalkFiles(path, runNoIgnore, func(path string) error {
+					paths = append(paths, path)
+					return nil
+				})
+			}
+			continue
+		}
+		if w.lintable(path, false) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	// A single job reuses the loaded runtimes instead of forking new ones per change
+	w.report(paths, 1)
+}
+
+// reload rebuilds the rules after the config or one of its includes changed and re-lints
+// every file. An invalid config is reported and the previous rules are kept.
+func (w *watcher) reload() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reloading config, keeping the previous rules:\n%v\n", err)
+		return
+	}
+	if err := w.setConfig(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s config changed, reloaded %d rules\n", time.Now().Format("15:04:05"), len(cfg.Rules))
+
+	var paths []string
+	for _, root := range w.roots {
+		err := pl.WalkFiles(root, runNoIgnore, func(path string) error {
+			paths = append(paths, path)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	w.report(paths, runJobs)
+}
+
+func (w *watcher) report(paths []string, jobs int) {
+	fmt.Fprintf(os.Stderr, "%s linting %d file(s)\n", time.Now().Format("15:04:05"), len(paths))
+	results, errs := pl.ProcessPaths(paths, w.cfg, jobs)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if runReportUnusedIgnores {
+		results = pl.ReportUnusedIgnores(results)
+	}
+	// Stale entries are meaningless when only some files were linted
+	results, _, err := applyBaseline(results)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if err := writeReports(results, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -1,8 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	pl "github.com/zph/polylint/pkg"
 )
@@ -68,6 +80,289 @@ func TestProcessFile(t *testing.T) {
 
 var simpleConfigFilePath = "./examples/simple.yaml"
 
+// cliEnv makes the test binary run the cli instead of the tests, see runCLI
+const cliEnv = "POLYLINT_TEST_RUN_CLI"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(cliEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs polylint with args in dir by executing the test binary again, returning its
+// stdout, stderr and exit code
+func runCLI(t *testing.T, dir, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), cliEnv+"=1", "HOME="+dir)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("Error running polylint %v: %v", args, err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+// startCLI runs polylint in the background like runCLI, sending each line it writes to stdout
+// or stderr to the returned channel. The process is killed when the test ends.
+func startCLI(t *testing.T, dir string, args ...string) <-chan string {
+	t.Helper()
+	reader, writer := io.Pipe()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), cliEnv+"=1", "HOME="+dir)
+	cmd.Stdout, cmd.Stderr = writer, writer
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Error starting polylint %v: %v", args, err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		writer.Close()
+	})
+	lines := make(chan string, 1024)
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	return lines
+}
+
+// waitForLine reads lines until one contains want, failing the test after a timeout
+func waitForLine(t *testing.T, lines <-chan string, want string) {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("Output ended before %q.", want)
+			}
+			if strings.Contains(line, want) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %q.", want)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	config := `---
+version: v0.0.1
+rules:
+- id: no-todo
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['TODO']
+`
+	fixmeRule := `- id: no-fixme
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['FIXME']
+`
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ".polylint.yaml")
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(configPath, config)
+	write(filepath.Join(dir, "src", "a.py"), "# FIXME\n")
+
+	lines := startCLI(t, dir, "run", "--config", configPath, "--no-cache", "--watch", "src")
+	waitForLine(t, lines, "watching 2 director(ies) for changes")
+
+	// A new file is linted on its own
+	write(filepath.Join(dir, "src", "b.py"), "# TODO\n")
+	waitForLine(t, lines, "linting 1 file(s)")
+	waitForLine(t, lines, "| src/b.py | 1 | line   1:3 | no-todo |")
+
+	// A changed config reloads the rules and re-lints every file
+	write(configPath, config+fixmeRule)
+	waitForLine(t, lines, "config changed, reloaded 2 rules")
+	waitForLine(t, lines, "linting 2 file(s)")
+	waitForLine(t, lines, "| src/a.py | 1 | line   1:3 | no-fixme |")
+
+	// A steady stream of events doesn't hold back linting until it stops
+	stop := make(chan bool)
+	streaming := make(chan bool)
+	go func() {
+		defer close(streaming)
+		for idx := 0; ; idx++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+				write(filepath.Join(dir, "src", "c.py"), fmt.Sprintf("# TODO %d\n", idx))
+			}
+		}
+	}()
+	waitForLine(t, lines, "| src/c.py | 1 | line   1:3 | no-todo |")
+	select {
+	case <-streaming:
+		t.Errorf("Linting waited for the stream of events to stop.")
+	default:
+	}
+	close(stop)
+	<-streaming
+}
+
+func TestInit(t *testing.T) {
+	var tests = []struct {
+		name         string
+		files        map[string]string
+		args         []string
+		exitCode     int
+		includePaths string
+		languages    string
+	}{
+		{"writes the starter config", nil, []string{"init"}, 0, `\.(py|js|ts|go|rb|sh)$`, ""},
+		{"refuses to overwrite", map[string]string{".polylint.yaml": "existing"}, []string{"init"}, 2, "", ""},
+		{"overwrites with force", map[string]string{".polylint.yaml": "existing"}, []string{"init", "--force"}, 0, `\.(py|js|ts|go|rb|sh)$`, ""},
+		{"writes to a path", nil, []string{"init", "lint.yaml"}, 0, `\.(py|js|ts|go|rb|sh)$`, ""},
+		{"detects languages", map[string]string{"a.py": "", "b.py": "", "src/c.go": "", "src/d.TSX": "", "README": ""}, []string{"init", "--detect"}, 0, `\.(py|go|tsx)$`, "python, go, typescript"},
+		{"detects nothing", map[string]string{"README": ""}, []string{"init", "--detect"}, 0, `\.(py|js|ts|go|rb|sh)$`, ""},
+		{"skips ignored files", map[string]string{".gitignore": "vendor/\n", "vendor/a.rb": "", "main.rs": ""}, []string{"init", "--detect"}, 0, `\.(rs)$`, "rust"},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, stderr, code := runCLI(t, dir, "", tt.args...)
+			if code != tt.exitCode {
+				t.Fatalf("Test #%d Exit code was incorrect, got: %d, want: %d. %s", idx, code, tt.exitCode, stderr)
+			}
+
+			configPath := filepath.Join(dir, ".polylint.yaml")
+			if len(tt.args) > 1 && !strings.HasPrefix(tt.args[1], "--") {
+				configPath = filepath.Join(dir, tt.args[1])
+			}
+			content, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatalf("Test #%d Error reading config: %v", idx, err)
+			}
+			if tt.exitCode != 0 {
+				if string(content) != "existing" || !strings.Contains(stderr, "already exists, use --force") {
+					t.Errorf("Test #%d Existing config was overwritten, got: %q %q.", idx, content, stderr)
+				}
+				return
+			}
+			cfg, err := pl.LoadConfigFile(string(content))
+			if err != nil {
+				t.Fatalf("Test #%d Error loading the starter config: %v", idx, err)
+			}
+			for _, rule := range cfg.Rules {
+				if rule.IncludePaths.String() != tt.includePaths {
+					t.Errorf("Test #%d include_paths of %s were incorrect, got: %s, want: %s.", idx, rule.Id, rule.IncludePaths, tt.includePaths)
+				}
+			}
+			detected := strings.Contains(string(content), "detected for: "+tt.languages+"\n")
+			if detected != (tt.languages != "") {
+				t.Errorf("Test #%d Detected languages were incorrect, got: %s, want: %s.", idx, content, tt.languages)
+			}
+		})
+	}
+}
+
+func TestStdin(t *testing.T) {
+	config := `---
+version: v0.0.1
+rules:
+- id: no-print
+  description: "Don't use print()"
+  recommendation: "Use logging instead."
+  severity: low
+  include_paths: '\.py$'
+  exclude_paths: '^vendor/'
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['print(']
+`
+	var tests = []struct {
+		name     string
+		args     []string
+		stdin    string
+		exitCode int
+		paths    []string
+		stderr   string
+	}{
+		{"reports the virtual path", []string{"--stdin-filename", "src/app.py"}, "import os\nprint(os.name)\n", 1, []string{"src/app.py"}, ""},
+		{"clean content", []string{"--stdin-filename", "src/app.py"}, "import os\n", 0, []string{}, ""},
+		{"filename isn't included", []string{"--stdin-filename", "src/app.go"}, "print(1)\n", 0, []string{}, ""},
+		{"filename is excluded", []string{"--stdin-filename", "vendor/app.py"}, "print(1)\n", 0, []string{}, ""},
+		{"requires a filename", nil, "print(1)\n", 2, nil, "--stdin requires --stdin-filename"},
+		{"rejects paths", []string{"--stdin-filename", "app.py", "src"}, "print(1)\n", 2, nil, "--stdin doesn't accept files or folders"},
+		{"rejects watch", []string{"--stdin-filename", "app.py", "--watch"}, "print(1)\n", 1, nil, "[stdin watch] were all set"},
+	}
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ".polylint.yaml")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"run", "--config", configPath, "--no-cache", "--format", "json", "--stdin"}, tt.args...)
+			stdout, stderr, code := runCLI(t, dir, tt.stdin, args...)
+			if code != tt.exitCode {
+				t.Fatalf("Test #%d Exit code was incorrect, got: %d, want: %d. %s", idx, code, tt.exitCode, stderr)
+			}
+			if tt.stderr != "" {
+				if !strings.Contains(stdout+stderr, tt.stderr) {
+					t.Errorf("Test #%d Error was incorrect, got: %s, want: %s.", idx, stdout+stderr, tt.stderr)
+				}
+				return
+			}
+			var report struct {
+				Findings []struct {
+					Path string `json:"path"`
+				} `json:"findings"`
+			}
+			if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+				t.Fatalf("Test #%d Error decoding the report %q: %v", idx, stdout, err)
+			}
+			paths := []string{}
+			for _, finding := range report.Findings {
+				paths = append(paths, finding.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.paths) {
+				t.Errorf("Test #%d Result was incorrect, got: %v, want: %v.", idx, paths, tt.paths)
+			}
+		})
+	}
+}
+
 func loadTestingConfigFile(path string) (string, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
@@ -97,3 +392,1629 @@ func TestConfigFileParsing(t *testing.T) {
 		})
 	}
 }
+
+func TestReporters(t *testing.T) {
+	simpleConfigFile, err := loadTestingConfigFile(simpleConfigFilePath)
+	if err != nil {
+		panic(err)
+	}
+	cfg, err := pl.LoadConfigFile(simpleConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	result, err := pl.ProcessFile(`print("A")`, "example.py", cfg)
+	if err != nil {
+		t.Fatalf("Error processing file: %v", err)
+	}
+	reports := []pl.FileReport{result}
+
+	var tests = []struct {
+		format   string
+		contains string
+	}{
+		{pl.TableFormat, "no-print-js"},
+		{pl.JSONFormat, `"rule_id": "no-print"`},
+		{pl.SARIFFormat, `"version": "2.1.0"`},
+		{pl.JUnitFormat, `<testsuite name="example.py" tests="5" failures="5">`},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			reporter, err := pl.NewReporter(tt.format)
+			if err != nil {
+				t.Fatalf("Test #%d Error creating reporter: %v", idx, err)
+			}
+			var buf bytes.Buffer
+			if err := reporter.Report(&buf, reports); err != nil {
+				t.Fatalf("Test #%d Error rendering report: %v", idx, err)
+			}
+			if !strings.Contains(buf.String(), tt.contains) {
+				t.Errorf("Test #%d Report was incorrect, missing %q in:\n%s", idx, tt.contains, buf.String())
+			}
+			if tt.format == pl.JSONFormat || tt.format == pl.SARIFFormat {
+				var decoded map[string]any
+				if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+					t.Errorf("Test #%d Report was not valid JSON: %v", idx, err)
+				}
+			}
+		})
+	}
+
+	if _, err := pl.NewReporter("yaml"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func TestProcessPaths(t *testing.T) {
+	simpleConfigFile, err := loadTestingConfigFile(simpleConfigFilePath)
+	if err != nil {
+		panic(err)
+	}
+	cfg, err := pl.LoadConfigFile(simpleConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("example%02d.py", i))
+		if err := os.WriteFile(path, []byte(`print("A")`), 0644); err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	results, errs := pl.ProcessPaths(paths, cfg, 4)
+	if len(errs) != 0 {
+		t.Fatalf("Errors processing paths: %v", errs)
+	}
+	if len(results) != len(paths) {
+		t.Fatalf("Result count was incorrect, got: %d, want: %d.", len(results), len(paths))
+	}
+	for idx, result := range results {
+		if result.Path != paths[idx] {
+			t.Errorf("Test #%d Result order was incorrect, got: %s, want: %s.", idx, result.Path, paths[idx])
+		}
+		if len(result.Findings) != 5 {
+			t.Errorf("Test #%d Result was incorrect, findings count: got: %d, want: %d.", idx, len(result.Findings), 5)
+		}
+	}
+}
+
+func TestConfigSources(t *testing.T) {
+	simpleConfigFile, err := loadTestingConfigFile(simpleConfigFilePath)
+	if err != nil {
+		t.Fatalf("Error reading config file: %v", err)
+	}
+	cfg, _ := pl.LoadConfigFileWithSource(simpleConfigFile, simpleConfigFilePath)
+	cwd, _ := os.Getwd()
+	var sources []string
+	for _, source := range cfg.Sources {
+		rel, _ := filepath.Rel(cwd, source)
+		sources = append(sources, filepath.ToSlash(rel))
+	}
+	if expected := "examples/simple.yaml,examples/basic.yaml"; strings.Join(sources, ",") != expected {
+		t.Errorf("Config sources were incorrect, got: %v, want: %v.", sources, expected)
+	}
+}
+
+func TestWalkFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":               "node_modules/\n*.log\n",
+		"..cache/a.py":             `print("A")`,
+		"..cache/debug.log":        "",
+		"node_modules/lib/a.py":    `print("A")`,
+		"src/.polylintignore":      "generated/\n!keep.log\n",
+		"src/generated/b.py":       `print("A")`,
+		"src/app.py":               `print("A")`,
+		"src/debug.log":            "",
+		"src/keep.log":             "",
+		"vendor/.gitignore":        "/ignored.py\n",
+		"vendor/ignored.py":        `print("A")`,
+		"vendor/nested/ignored.py": `print("A")`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Error creating dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+	}
+
+	var tests = []struct {
+		name     string
+		noIgnore bool
+		expected []string
+	}{
+		{"respects ignore files", false, []string{"..cache/a.py", ".gitignore", "src/.polylintignore", "src/app.py", "src/keep.log", "vendor/.gitignore", "vendor/nested/ignored.py"}},
+		{"no-ignore visits everything", true, []string{"..cache/a.py", "..cache/debug.log", ".gitignore", "node_modules/lib/a.py", "src/.polylintignore", "src/app.py", "src/debug.log", "src/generated/b.py", "src/keep.log", "vendor/.gitignore", "vendor/ignored.py", "vendor/nested/ignored.py"}},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var visited []string
+			err := pl.WalkFiles(dir, tt.noIgnore, func(path string) error {
+				rel, _ := filepath.Rel(dir, path)
+				visited = append(visited, filepath.ToSlash(rel))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Test #%d Error walking files: %v", idx, err)
+			}
+			if strings.Join(visited, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Test #%d Visited files were incorrect, got: %v, want: %v.", idx, visited, tt.expected)
+			}
+		})
+	}
+
+	var dirs []string
+	err := pl.WalkDirs(dir, false, func(path string) error {
+		rel, _ := filepath.Rel(dir, path)
+		dirs = append(dirs, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error walking dirs: %v", err)
+	}
+	if expected := ".,..cache,src,vendor,vendor/nested"; strings.Join(dirs, ",") != expected {
+		t.Errorf("Visited dirs were incorrect, got: %v, want: %v.", dirs, expected)
+	}
+}
+
+const severityConfigFile = `---
+version: v0.0.1
+rules:
+- id: no-todo
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['TODO']
+- id: no-eval
+  severity: high
+  include_paths: '\.py$'
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['eval(']
+`
+
+func TestFindingsAtOrAbove(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(severityConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	var tests = []struct {
+		name          string
+		content       string
+		threshold     string
+		findingsCount int
+	}{
+		{"low threshold counts everything", "# TODO\neval(x)", "low", 2},
+		{"medium threshold skips low", "# TODO\neval(x)", "medium", 1},
+		{"high threshold skips low", "# TODO", "high", 0},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threshold, err := pl.ParseSeverityLevel(tt.threshold)
+			if err != nil {
+				t.Fatalf("Test #%d Error parsing severity: %v", idx, err)
+			}
+			result, err := pl.ProcessFile(tt.content, "example.py", cfg)
+			if err != nil {
+				t.Fatalf("Test #%d Error processing file: %v", idx, err)
+			}
+			if got := len(result.FindingsAtOrAbove(threshold)); got != tt.findingsCount {
+				t.Errorf("Test #%d Result was incorrect, findings count: got: %d, want: %d.", idx, got, tt.findingsCount)
+			}
+		})
+	}
+
+	if _, err := pl.ParseSeverityLevel("critical"); err == nil {
+		t.Errorf("Expected an error for an unknown severity")
+	}
+}
+
+const invalidConfigFile = `---
+version: v0.0.1
+rules:
+- id: bad-severity
+  severity: critical
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['x']
+- id: bad-regexp
+  severity: low
+  fn:
+    type: builtin
+    scope: line
+    name: regexp
+    args: ['(']
+- id: missing-args
+  severity: low
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+- id: bad-js
+  severity: low
+  fn:
+    type: js
+    scope: file
+    name: fn
+    body: const fn = (
+- id: valid
+  severity: low
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['x']
+- id: valid
+  severity: low
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['y']
+`
+
+func TestConfigErrors(t *testing.T) {
+	cfg, err := pl.LoadConfigFileWithSource(invalidConfigFile, "invalid.yaml")
+	var configErrs pl.ConfigErrors
+	if !errors.As(err, &configErrs) {
+		t.Fatalf("Expected ConfigErrors, got: %v", err)
+	}
+
+	var tests = []struct {
+		ruleId string
+		line   int
+	}{
+		{"bad-severity", 5},
+		{"bad-regexp", 17},
+		{"missing-args", 20},
+		{"bad-js", 30},
+	}
+	if len(configErrs) != len(tests) {
+		t.Fatalf("Error count was incorrect, got: %d, want: %d.\n%v", len(configErrs), len(tests), err)
+	}
+	for idx, tt := range tests {
+		if configErrs[idx].RuleId != tt.ruleId || configErrs[idx].Line != tt.line || configErrs[idx].Source != "invalid.yaml" {
+			t.Errorf("Test #%d Error was incorrect, got: %v, want rule %s on line %d.", idx, configErrs[idx], tt.ruleId, tt.line)
+		}
+	}
+
+	if len(cfg.Rules) != 2 {
+		t.Fatalf("Valid rules should still load, got: %d, want: %d.", len(cfg.Rules), 2)
+	}
+	err = pl.ValidateConfigFile(cfg)
+	if !errors.As(err, &configErrs) || len(configErrs) != 1 || configErrs[0].Line != 38 {
+		t.Errorf("Expected a single duplicate id error on line 38, got: %v", err)
+	}
+}
+
+const fixConfigFile = `---
+version: v0.0.1
+rules:
+- id: print-to-logging
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: builtin
+    scope: line
+    name: replace
+    args: ['print\((.*)\)', 'logging.info($1)']
+- id: no-print-js
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: js
+    scope: line
+    name: fn
+    body: |
+      const fn = (_p, _i, line) => line.startsWith('print') ? {value: true, fix: {start: 0, end: 5, replacement: 'log'}} : false
+- id: trailing-newline
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: js
+    scope: file
+    name: fn
+    body: |
+      const fn = (_p, _i, file) => file.endsWith('\n') ? false : {value: true, fix: {start: file.length, end: file.length, replacement: '\n'}}
+`
+
+func TestApplyFixes(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(fixConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	var tests = []struct {
+		name      string
+		content   string
+		expected  string
+		conflicts int
+		diff      string
+	}{
+		{"overlapping fixes conflict", "x = 1\nprint(x)", "x = 1\nlogging.info(x)\n", 1, "-print(x)\n\\ No newline at end of file\n+logging.info(x)\n"},
+		{"nothing to fix", "x = 1\n", "x = 1\n", 0, ""},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := pl.ProcessFile(tt.content, "example.py", cfg)
+			if err != nil {
+				t.Fatalf("Test #%d Error processing file: %v", idx, err)
+			}
+			fixed := pl.ApplyFixes("example.py", tt.content, result.Findings)
+			if fixed.After != tt.expected {
+				t.Errorf("Test #%d Fixed content was incorrect, got: %q, want: %q.", idx, fixed.After, tt.expected)
+			}
+			if len(fixed.Conflicts) != tt.conflicts {
+				t.Errorf("Test #%d Conflict count was incorrect, got: %d, want: %d.", idx, len(fixed.Conflicts), tt.conflicts)
+			}
+			diff := pl.UnifiedDiff("example.py", fixed.Before, fixed.After)
+			if !strings.Contains(diff, tt.diff) {
+				t.Errorf("Test #%d Diff was incorrect, missing %q in:\n%s", idx, tt.diff, diff)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var long []string
+	for idx := 1; idx <= 200; idx++ {
+		long = append(long, fmt.Sprintf("line %d\n", idx))
+	}
+	longBefore := strings.Join(long, "")
+	longAfter := strings.Replace(strings.Replace(longBefore, "line 50\n", "changed 50\n", 1), "line 150\n", "", 1)
+
+	var tests = []struct {
+		name   string
+		before string
+		after  string
+		diff   string
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", ""},
+		{"insert at start", "a\nb\n", "x\na\nb\n", "--- f\n+++ f\n@@ -1,2 +1,3 @@\n+x\n a\n b\n"},
+		{"delete at end", "a\nb\nc\n", "a\nb\n", "--- f\n+++ f\n@@ -1,3 +1,2 @@\n a\n b\n-c\n"},
+		{"replace everything", "a\nb\n", "c\n", "--- f\n+++ f\n@@ -1,2 +1 @@\n-a\n-b\n+c\n"},
+		{"from empty", "", "a\n", "--- f\n+++ f\n@@ -0,0 +1 @@\n+a\n"},
+		{"separate hunks", longBefore, longAfter, "--- f\n+++ f\n" +
+			"@@ -47,7 +47,7 @@\n line 47\n line 48\n line 49\n-line 50\n+changed 50\n line 51\n line 52\n line 53\n" +
+			"@@ -147,7 +147,6 @@\n line 147\n line 148\n line 149\n-line 150\n line 151\n line 152\n line 153\n"},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := pl.UnifiedDiff("f", tt.before, tt.after)
+			if diff != tt.diff {
+				t.Errorf("Test #%d Result was incorrect, got: %q, want: %q.", idx, diff, tt.diff)
+			}
+		})
+	}
+}
+
+func TestFixDryRunOutput(t *testing.T) {
+	var tests = []struct {
+		format     string
+		diffStdout bool
+	}{
+		{"table", true},
+		{"json", false},
+		{"sarif", false},
+	}
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ".polylint.yaml")
+	if err := os.WriteFile(configPath, []byte(fixConfigFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "example.py"), []byte("print(x)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diff := "-print(x)\n+logging.info(x)\n"
+	for idx, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			stdout, stderr, code := runCLI(t, dir, "", "run", "--config", configPath, "--no-cache", "--format", tt.format, "--fix-dry-run", "example.py")
+			if code == 2 {
+				t.Fatalf("Test #%d Run failed: %s %s", idx, stdout, stderr)
+			}
+			if strings.Contains(stdout, diff) != tt.diffStdout || strings.Contains(stderr, diff) == tt.diffStdout {
+				t.Errorf("Test #%d Diff was written to the wrong stream, stdout: %q, stderr: %q.", idx, stdout, stderr)
+			}
+			if !tt.diffStdout && !json.Valid([]byte(stdout)) {
+				t.Errorf("Test #%d Report wasn't valid json: %q.", idx, stdout)
+			}
+		})
+	}
+}
+
+const rangeConfigFile = `---
+version: v0.0.1
+rules:
+- id: no-print
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['print(']
+- id: no-todo-file
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: builtin
+    scope: file
+    name: regexp
+    args: ['TODO\w*']
+- id: no-x-js
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: js
+    scope: line
+    name: fn
+    body: |
+      const fn = (_p, _i, line) => [...line.matchAll(/x/g)].map(m => ({start: m.index, end: m.index + 1}))
+`
+
+func TestFindingRanges(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(rangeConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	result, err := pl.ProcessFile("a = 1\nprint(1); print(2) # TODO\nx + x", "example.py", cfg)
+	if err != nil {
+		t.Fatalf("Error processing file: %v", err)
+	}
+
+	var tests = []struct {
+		ruleId      string
+		lineNo      int
+		startColumn int
+		endColumn   int
+		start       int
+		end         int
+	}{
+		{"no-print", 2, 1, 7, 6, 12},
+		{"no-print", 2, 11, 17, 16, 22},
+		{"no-x-js", 3, 1, 2, 32, 33},
+		{"no-x-js", 3, 5, 6, 36, 37},
+		{"no-todo-file", 2, 22, 26, 27, 31},
+	}
+	if len(result.Findings) != len(tests) {
+		t.Fatalf("Result was incorrect, findings count: got: %d, want: %d.", len(result.Findings), len(tests))
+	}
+	for idx, tt := range tests {
+		finding := result.Findings[idx]
+		if finding.RuleId != tt.ruleId || finding.LineNo != tt.lineNo || finding.StartColumn != tt.startColumn || finding.EndColumn != tt.endColumn {
+			t.Errorf("Test #%d Finding was incorrect, got: %s %d:%d-%d, want: %s %d:%d-%d.", idx, finding.RuleId, finding.LineNo, finding.StartColumn, finding.EndColumn, tt.ruleId, tt.lineNo, tt.startColumn, tt.endColumn)
+		}
+		if finding.Range == nil || finding.Range.Start != tt.start || finding.Range.End != tt.end {
+			t.Errorf("Test #%d Range was incorrect, got: %v, want: %d-%d.", idx, finding.Range, tt.start, tt.end)
+		}
+	}
+}
+
+const richJsConfigFile = `---
+version: v0.0.1
+rules:
+- id: no-print-file
+  recommendation: Use logging instead.
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: js
+    scope: file
+    name: fn
+    body: |
+      const fn = (_p, _i, file) => file.split('\n').flatMap((line, idx) =>
+        line.includes('print') ? [{line: idx + 1, column: line.indexOf('print') + 1, message: 'print on line ' + (idx + 1), severity: idx === 0 ? 'high' : undefined}] : [])
+- id: bool-js
+  recommendation: Avoid eval.
+  severity: medium
+  include_paths: '\.py$'
+  fn:
+    type: js
+    scope: line
+    name: fn
+    body: const fn = (_p, _i, line) => line.includes('eval')
+`
+
+func TestJsTruthyResults(t *testing.T) {
+	var tests = []struct {
+		body  string
+		lines []int
+	}{
+		{"const fn = (_p, _i, line) => line.match(/eval/)", []int{2}},
+		{"const fn = (_p, _i, line) => line.indexOf('eval') + 1", []int{2}},
+		{"const fn = (_p, _i, line) => line.startsWith('print') ? 'print' : ''", []int{1}},
+		{"const fn = (_p, _i, line) => line.split('(')", []int{1, 2, 3}},
+		{"const fn = (_p, _i, line) => []", nil},
+		{"const fn = (_p, _i, line) => line.includes('eval') ? [{start: 0, end: 4}] : null", []int{2}},
+	}
+	for idx, tt := range tests {
+		config := fmt.Sprintf(`---
+version: v0.0.1
+rules:
+- id: truthy-js
+  severity: low
+  include_paths: '.*'
+  fn:
+    type: js
+    scope: line
+    name: fn
+    body: %q
+`, tt.body)
+		cfg, err := pl.LoadConfigFile(config)
+		if err != nil {
+			t.Fatalf("Test #%d Error loading config file: %v", idx, err)
+		}
+		result, err := pl.ProcessFile("print(1)\neval(x)\n  print(2)", "example.py", cfg)
+		if err != nil {
+			t.Fatalf("Test #%d Error processing file: %v", idx, err)
+		}
+		var lines []int
+		for _, finding := range result.Findings {
+			lines = append(lines, finding.LineNo)
+		}
+		if fmt.Sprint(lines) != fmt.Sprint(tt.lines) {
+			t.Errorf("Test #%d Result was incorrect, got: %v, want: %v.", idx, lines, tt.lines)
+		}
+	}
+}
+
+func TestRichJsFindings(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(richJsConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	result, err := pl.ProcessFile("print(1)\neval(x)\n  print(2)", "example.py", cfg)
+	if err != nil {
+		t.Fatalf("Error processing file: %v", err)
+	}
+
+	var tests = []struct {
+		ruleId   string
+		lineNo   int
+		column   int
+		message  string
+		severity string
+	}{
+		{"bool-js", 2, 0, "Avoid eval.", "medium"},
+		{"no-print-file", 1, 1, "print on line 1", "high"},
+		{"no-print-file", 3, 3, "print on line 3", "low"},
+	}
+	if len(result.Findings) != len(tests) {
+		t.Fatalf("Result was incorrect, findings count: got: %d, want: %d.", len(result.Findings), len(tests))
+	}
+	for idx, tt := range tests {
+		finding := result.Findings[idx]
+		if finding.RuleId != tt.ruleId || finding.LineNo != tt.lineNo || finding.StartColumn != tt.column || finding.Message != tt.message || finding.Severity.String() != tt.severity {
+			t.Errorf("Test #%d Finding was incorrect, got: %s %d:%d %q %s, want: %s %d:%d %q %s.", idx,
+				finding.RuleId, finding.LineNo, finding.StartColumn, finding.Message, finding.Severity,
+				tt.ruleId, tt.lineNo, tt.column, tt.message, tt.severity)
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(severityConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	process := func(content string) []pl.FileReport {
+		result, err := pl.ProcessFile(content, "example.py", cfg)
+		if err != nil {
+			t.Fatalf("Error processing file: %v", err)
+		}
+		return []pl.FileReport{result}
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := pl.NewBaseline(process("# TODO\neval(x)\n# TODO")).Write(path); err != nil {
+		t.Fatalf("Error writing baseline: %v", err)
+	}
+	baseline, err := pl.LoadBaseline(path)
+	if err != nil {
+		t.Fatalf("Error loading baseline: %v", err)
+	}
+	if len(baseline.Entries) != 2 {
+		t.Fatalf("Baseline entry count was incorrect, got: %d, want: %d.", len(baseline.Entries), 2)
+	}
+
+	var tests = []struct {
+		name          string
+		content       string
+		findingsCount int
+		staleCount    int
+	}{
+		{"moved lines are still baselined", "\n\n  # TODO\n# TODO\neval(x)", 0, 0},
+		{"new findings are reported", "# TODO\neval(x)\n# TODO\n# TODO\neval(y)", 2, 0},
+		{"fixed findings are stale", "# TODO", 0, 2},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered, stale := baseline.Filter(process(tt.content))
+			if len(filtered[0].Findings) != tt.findingsCount {
+				t.Errorf("Test #%d Result was incorrect, findings count: got: %d, want: %d.", idx, len(filtered[0].Findings), tt.findingsCount)
+			}
+			if len(stale) != tt.staleCount {
+				t.Errorf("Test #%d Stale entry count was incorrect, got: %d, want: %d.", idx, len(stale), tt.staleCount)
+			}
+		})
+	}
+}
+
+func TestFilterChangedLines(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(severityConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	result, err := pl.ProcessFile("# TODO\neval(x)\n# TODO", "src/example.py", cfg)
+	if err != nil {
+		t.Fatalf("Error processing file: %v", err)
+	}
+
+	var tests = []struct {
+		name          string
+		changed       pl.ChangedLines
+		findingsCount int
+	}{
+		{"only changed lines are kept", pl.ChangedLines{"src/example.py": {2: true, 3: true}}, 2},
+		{"untracked files keep every line", pl.ChangedLines{"src/example.py": nil}, 3},
+		{"unchanged files keep nothing", pl.ChangedLines{"src/other.py": {1: true}}, 0},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered := pl.FilterChangedLines([]pl.FileReport{result}, tt.changed)
+			if len(filtered[0].Findings) != tt.findingsCount {
+				t.Errorf("Test #%d Result was incorrect, findings count: got: %d, want: %d.", idx, len(filtered[0].Findings), tt.findingsCount)
+			}
+		})
+	}
+}
+
+func TestGitChangedPaths(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	// Paths with spaces, non-ASCII characters and quotes are quoted or tab terminated by git
+	// unless read with -z
+	files := []string{"plain.txt", "with space.txt", "café.txt", `quote".txt`}
+	run := func(args ...string) {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte("one\ntwo\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte("one\nchanged\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile("new é.txt", []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changedFiles, err := pl.GitChangedFiles("HEAD", false)
+	if err != nil {
+		t.Fatalf("Error listing changed files: %v", err)
+	}
+	want := append(append([]string{}, "café.txt", "plain.txt", `quote".txt`, "with space.txt"), "new é.txt")
+	if fmt.Sprint(changedFiles) != fmt.Sprint(want) {
+		t.Errorf("Changed files were incorrect, got: %q, want: %q.", changedFiles, want)
+	}
+
+	changedLines, err := pl.GitChangedLines("HEAD", false)
+	if err != nil {
+		t.Fatalf("Error reading changed lines: %v", err)
+	}
+	for idx, file := range files {
+		if !changedLines.Contains(file, 2) || changedLines.Contains(file, 1) {
+			t.Errorf("Test #%d Changed lines of %q were incorrect, got: %v.", idx, file, changedLines[file])
+		}
+	}
+	if !changedLines.Contains("new é.txt", 1) {
+		t.Errorf("Untracked file was missing from the changed lines, got: %v.", changedLines)
+	}
+}
+
+func TestStagedDiffLines(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	config := `---
+version: v0.0.1
+rules:
+- id: no-todo
+  description: "No TODOs"
+  recommendation: "Open an issue instead."
+  severity: low
+  include_paths: '\.txt$'
+  fn:
+    type: builtin
+    scope: line
+    name: contains
+    args: ['TODO']
+`
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	var tests = []struct {
+		name     string
+		staged   string
+		unstaged string
+		lines    []int
+	}{
+		{"fully staged", "one\nTODO\n", "one\nTODO\n", []int{2}},
+		{"unstaged lines above", "one\nTODO\n", "zero\nzero\none\nTODO\n", []int{2}},
+		{"unstaged violation", "one\ntwo\n", "one\nTODO\ntwo\n", []int{}},
+		{"unstaged fix", "one\nTODO\n", "one\ndone\n", []int{2}},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, ".polylint.yaml")
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			run := func(args ...string) {
+				cmd := exec.Command("git", args...)
+				cmd.Dir = dir
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Fatalf("git %v: %v: %s", args, err, out)
+				}
+			}
+			write := func(content string) {
+				if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			run("init", "-q")
+			write("one\n")
+			run("add", ".")
+			run("commit", "-q", "-m", "initial")
+			write(tt.staged)
+			run("add", "notes.txt")
+			write(tt.unstaged)
+
+			stdout, stderr, code := runCLI(t, dir, "", "run", "--config", configPath, "--no-cache", "--format", "json", "--staged", "--diff-lines-only")
+			if code == 2 {
+				t.Fatalf("Test #%d Run failed: %s %s", idx, stdout, stderr)
+			}
+			var report struct {
+				Findings []struct {
+					LineNo int `json:"line_no"`
+				} `json:"findings"`
+			}
+			if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+				t.Fatalf("Test #%d Error decoding the report %q: %v", idx, stdout, err)
+			}
+			lines := []int{}
+			for _, finding := range report.Findings {
+				lines = append(lines, finding.LineNo)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("Test #%d Result was incorrect, got: %v, want: %v.", idx, lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestReadPathList(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"newline separated", "a.py\nsrc/b.py\n", []string{"a.py", "src/b.py"}},
+		{"crlf separated", "a.py\r\nb.py", []string{"a.py", "b.py"}},
+		{"nul separated", "a.py\x00with\nnewline.py\x00", []string{"a.py", "with\nnewline.py"}},
+		{"empty", "", nil},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pl.ReadPathList(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Test #%d Error reading paths: %v", idx, err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Test #%d Result was incorrect, got: %q, want: %q.", idx, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLSPServer(t *testing.T) {
+	var in bytes.Buffer
+	send := func(msg map[string]any) {
+		msg["jsonrpc"] = "2.0"
+		body, _ := json.Marshal(msg)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	uri := "file:///workspace/example.py"
+	send(map[string]any{"id": 1, "method": "initialize", "params": map[string]any{"rootUri": "file:///workspace"}})
+	send(map[string]any{"method": "textDocument/didOpen", "params": map[string]any{
+		"textDocument": map[string]any{"uri": uri, "version": 1, "text": "ok\n  eval(x) # TODO\n"},
+	}})
+	send(map[string]any{"id": 2, "method": "shutdown"})
+	send(map[string]any{"method": "exit"})
+
+	var out bytes.Buffer
+	server := pl.NewLSPServer(&in, &out, ".polylint.yaml", func() (pl.ConfigFile, error) {
+		return pl.LoadConfigFile(severityConfigFile)
+	})
+	if err := server.Serve(); err != nil {
+		t.Fatalf("Error serving: %v", err)
+	}
+
+	var diagnostics []struct {
+		Code     string
+		Severity int
+		Range    struct{ Start, End struct{ Line, Character int } }
+	}
+	for _, chunk := range strings.Split(out.String(), "Content-Length: ")[1:] {
+		var msg struct {
+			Method string
+			Params struct {
+				Diagnostics json.RawMessage
+			}
+		}
+		if err := json.Unmarshal([]byte(chunk[strings.Index(chunk, "\r\n\r\n")+4:]), &msg); err != nil {
+			t.Fatalf("Error decoding message: %v", err)
+		}
+		if msg.Method == "textDocument/publishDiagnostics" {
+			json.Unmarshal(msg.Params.Diagnostics, &diagnostics)
+		}
+	}
+
+	if len(diagnostics) != 2 {
+		t.Fatalf("Diagnostics count was incorrect, got: %d, want: %d.", len(diagnostics), 2)
+	}
+	var tests = []struct {
+		code      string
+		severity  int
+		line      int
+		character int
+	}{
+		{"no-todo", 3, 1, 12},
+		{"no-eval", 1, 1, 2},
+	}
+	for idx, tt := range tests {
+		d := diagnostics[idx]
+		if d.Code != tt.code || d.Severity != tt.severity || d.Range.Start.Line != tt.line || d.Range.Start.Character != tt.character {
+			t.Errorf("Test #%d Result was incorrect, got: %+v, want: %+v.", idx, d, tt)
+		}
+	}
+}
+
+func TestLSPConfigWatcher(t *testing.T) {
+	var tests = []struct {
+		name         string
+		capabilities map[string]any
+		registered   bool
+	}{
+		{"without capabilities", map[string]any{}, false},
+		{"without dynamic registration", map[string]any{"workspace": map[string]any{"didChangeWatchedFiles": map[string]any{"dynamicRegistration": false}}}, false},
+		{"with dynamic registration", map[string]any{"workspace": map[string]any{"didChangeWatchedFiles": map[string]any{"dynamicRegistration": true}}}, true},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in bytes.Buffer
+			send := func(msg map[string]any) {
+				msg["jsonrpc"] = "2.0"
+				body, _ := json.Marshal(msg)
+				fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+			}
+			send(map[string]any{"id": 1, "method": "initialize", "params": map[string]any{"rootUri": "file:///workspace", "capabilities": tt.capabilities}})
+			send(map[string]any{"method": "initialized", "params": map[string]any{}})
+			send(map[string]any{"id": 2, "method": "shutdown"})
+			send(map[string]any{"method": "exit"})
+
+			var out bytes.Buffer
+			server := pl.NewLSPServer(&in, &out, ".polylint.yaml", func() (pl.ConfigFile, error) {
+				return pl.LoadConfigFile(severityConfigFile)
+			})
+			if err := server.Serve(); err != nil {
+				t.Fatalf("Test #%d Error serving: %v", idx, err)
+			}
+			registered := strings.Contains(out.String(), "client/registerCapability")
+			if registered != tt.registered {
+				t.Errorf("Test #%d Result was incorrect, got: %v, want: %v.", idx, registered, tt.registered)
+			}
+		})
+	}
+}
+
+func TestBlockCommentDirectives(t *testing.T) {
+	// The directives the lsp quick fixes insert in languages without line comments
+	cfg, err := pl.LoadConfigFile(builtinConfig("line", "contains", "[TODO]"))
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	var tests = []struct {
+		path    string
+		content string
+	}{
+		{"index.html", "<!-- polylint disable-next-line=contains -->\n<p>TODO</p>"},
+		{"notes.md", "<!-- polylint disable-for-file=contains -->\nTODO\nTODO"},
+		{"pom.xml", "<!-- polylint disable-next-line=contains -- reason -->\n<!-- TODO -->"},
+		{"site.css", "/* polylint disable-next-line=contains */\na { color: red } /* TODO */"},
+	}
+	for idx, tt := range tests {
+		result, err := pl.ProcessFile(tt.content, tt.path, cfg)
+		if err != nil {
+			t.Fatalf("Test #%d Error processing file: %v", idx, err)
+		}
+		if len(result.Findings) != 0 || len(result.Warnings) != 0 {
+			t.Errorf("Test #%d Result was incorrect, got: %v %v, want no findings.", idx, result.Findings, result.Warnings)
+		}
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg, err := pl.LoadConfigFile(severityConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	cache, err := pl.NewResultCache(cfg)
+	if err != nil {
+		t.Fatalf("Error creating cache: %v", err)
+	}
+	content := []byte("# TODO\neval(x)\n")
+	report, err := pl.ProcessFile(string(content), "example.py", cfg)
+	if err != nil {
+		t.Fatalf("Error processing file: %v", err)
+	}
+	cache.Put("example.py", content, report)
+
+	changedCfg, err := pl.LoadConfigFile(strings.Replace(severityConfigFile, "severity: low", "severity: medium", 1))
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	changedCache, err := pl.NewResultCache(changedCfg)
+	if err != nil {
+		t.Fatalf("Error creating cache: %v", err)
+	}
+
+	var tests = []struct {
+		name    string
+		cache   *pl.ResultCache
+		path    string
+		content []byte
+		hit     bool
+	}{
+		{"unchanged file hits", cache, "example.py", content, true},
+		{"changed content misses", cache, "example.py", []byte("# TODO\n"), false},
+		{"other path misses", cache, "other.py", content, false},
+		{"changed rules miss", changedCache, "example.py", content, false},
+		{"nil cache misses", nil, "example.py", content, false},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cached, hit := tt.cache.Get(tt.path, tt.content)
+			if hit != tt.hit {
+				t.Fatalf("Test #%d Cache hit was incorrect, got: %v, want: %v.", idx, hit, tt.hit)
+			}
+			if !hit {
+				return
+			}
+			if len(cached.Findings) != len(report.Findings) {
+				t.Fatalf("Test #%d Findings count was incorrect, got: %d, want: %d.", idx, len(cached.Findings), len(report.Findings))
+			}
+			for i, finding := range cached.Findings {
+				if finding.Rule.Id != finding.RuleId || finding.Severity != report.Findings[i].Severity || finding.Range == nil {
+					t.Errorf("Test #%d Cached finding was incorrect, got: %+v, want: %+v.", idx, finding, report.Findings[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBlockIgnores(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(severityConfigFile)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+
+	var tests = []struct {
+		name          string
+		content       string
+		findingLines  []int
+		warningsCount int
+	}{
+		{"block disables a region", "# TODO\n# polylint disable=no-todo\n# TODO\neval(x)\n# TODO\n# polylint enable=no-todo\n# TODO", []int{1, 4, 7}, 0},
+		{"disable-all silences every rule", "# polylint disable-all\n# TODO\neval(x)\n# polylint enable-all\neval(y)", []int{5}, 0},
+		{"wildcard ids match rule ids", "# polylint disable=no-*\n# TODO\neval(x)\n# polylint enable=*\n# TODO", []int{5}, 0},
+		{"enable only closes its own id", "# polylint disable=no-todo,no-eval\n# polylint enable=no-eval\neval(x) # TODO\n# polylint enable=no-todo\n", []int{3}, 0},
+		{"unclosed disable only applies to the next line", "# polylint disable=no-todo\n# TODO\n# TODO", []int{3}, 1},
+		{"enable without disable warns", "# TODO\n# polylint enable=no-todo\n# TODO", []int{1, 3}, 1},
+		{"unknown directives warn", "# polylint disable-xyz=no-todo\n# TODO", []int{2}, 1},
+		{"next-line still applies to one line", "# polylint disable-next-line=*\n# TODO\n# TODO", []int{3}, 0},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := pl.ProcessFile(tt.content, "example.py", cfg)
+			if err != nil {
+				t.Fatalf("Test #%d Error processing file: %v", idx, err)
+			}
+			var lines []int
+			for _, finding := range result.Findings {
+				lines = append(lines, finding.LineNo)
+			}
+			if fmt.Sprint(lines) != fmt.Sprint(tt.findingLines) {
+				t.Errorf("Test #%d Finding lines were incorrect, got: %v, want: %v.", idx, lines, tt.findingLines)
+			}
+			if len(result.Warnings) != tt.warningsCount {
+				t.Errorf("Test #%d Warnings count was incorrect, got: %v, want: %d.", idx, result.Warnings, tt.warningsCount)
+			}
+		})
+	}
+}
+
+func TestIgnoreReasons(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(strings.Replace(severityConfigFile, "version: v0.0.1", "version: v0.0.1\nrequire_ignore_reason: true", 1))
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	if !cfg.RequireIgnoreReason {
+		t.Fatalf("require_ignore_reason was not loaded")
+	}
+
+	var tests = []struct {
+		name     string
+		content  string
+		reason   string
+		ruleIds  []string
+		reported []string
+	}{
+		{"reason after --", "# polylint disable-next-line=no-todo -- tracked in #12\n# TODO", "tracked in #12", nil, nil},
+		{"reason in a block comment", "/* polylint disable=no-todo -- legacy */\n# TODO\n/* polylint enable=no-todo */", "legacy", nil, nil},
+		{"missing reason", "# polylint disable-next-line=no-todo\n# TODO", "", []string{"polylint/missing-ignore-reason"}, nil},
+		{"unused ignore", "# polylint disable-next-line=no-eval -- not needed\n# TODO", "not needed", []string{"no-todo"}, []string{"no-todo", "polylint/unused-ignore"}},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := pl.ProcessFile(tt.content, "example.py", cfg)
+			if err != nil {
+				t.Fatalf("Test #%d Error processing file: %v", idx, err)
+			}
+			if len(result.Ignores) == 0 || result.Ignores[0].Reason != tt.reason {
+				t.Errorf("Test #%d Reason was incorrect, got: %+v, want: %q.", idx, result.Ignores, tt.reason)
+			}
+			var ruleIds []string
+			for _, finding := range result.Findings {
+				ruleIds = append(ruleIds, finding.RuleId)
+			}
+			if fmt.Sprint(ruleIds) != fmt.Sprint(tt.ruleIds) {
+				t.Errorf("Test #%d Findings were incorrect, got: %v, want: %v.", idx, ruleIds, tt.ruleIds)
+			}
+
+			reported := pl.ReportUnusedIgnores([]pl.FileReport{result})
+			var reportedIds []string
+			for _, finding := range reported[0].Findings {
+				reportedIds = append(reportedIds, finding.RuleId)
+			}
+			if tt.reported == nil {
+				tt.reported = tt.ruleIds
+			}
+			if fmt.Sprint(reportedIds) != fmt.Sprint(tt.reported) {
+				t.Errorf("Test #%d Unused ignore findings were incorrect, got: %v, want: %v.", idx, reportedIds, tt.reported)
+			}
+		})
+	}
+}
+
+const pathRuleConfig = `- id: no-py-path
+  severity: low
+  include_paths: '\.py$'
+  fn:
+    type: builtin
+    scope: path
+    name: contains
+    args: ['.py']
+`
+
+func TestSuppressions(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(richJsConfigFile + pathRuleConfig)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+
+	var tests = []struct {
+		name       string
+		content    string
+		findings   []string
+		suppressed []string
+	}{
+		{"disable-for-path suppresses path rules", "# polylint disable-for-path=no-py-path -- generated\nprint(1)", []string{"no-print-file"}, []string{"no-py-path path:1 generated"}},
+		{"disable-for-path doesn't apply to file rules", "# polylint disable-for-path=no-*-file\nprint(1)", []string{"no-print-file", "no-py-path"}, nil},
+		{"line ignores apply to file findings on the line", "# polylint disable-next-line=no-*-file\nprint(1)\nprint(2)", []string{"no-print-file", "no-py-path"}, []string{"no-print-file line:1 "}},
+		{"line ignores don't apply to path rules", "# polylint disable-next-line=no-py-path\nprint(1)", []string{"no-print-file", "no-py-path"}, nil},
+		{"disable-for-file applies to every scope", "# polylint disable-for-file=* -- vendored\neval(x)\nprint(1)", nil, []string{"bool-js file:1 vendored", "no-print-file file:1 vendored", "no-py-path file:1 vendored"}},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := pl.ProcessFile(tt.content, "example.py", cfg)
+			if err != nil {
+				t.Fatalf("Test #%d Error processing file: %v", idx, err)
+			}
+			var findings, suppressed []string
+			for _, finding := range result.Findings {
+				findings = append(findings, finding.RuleId)
+			}
+			for _, finding := range result.Suppressed {
+				by := finding.SuppressedBy
+				suppressed = append(suppressed, fmt.Sprintf("%s %s:%d %s", finding.RuleId, by.Scope, by.SourceLineNo, by.Reason))
+			}
+			if fmt.Sprint(findings) != fmt.Sprint(tt.findings) {
+				t.Errorf("Test #%d Findings were incorrect, got: %v, want: %v.", idx, findings, tt.findings)
+			}
+			if fmt.Sprint(suppressed) != fmt.Sprint(tt.suppressed) {
+				t.Errorf("Test #%d Suppressed findings were incorrect, got: %q, want: %q.", idx, suppressed, tt.suppressed)
+			}
+		})
+	}
+}
+
+const overridesConfig = `overrides:
+- files: ['scripts/**']
+  rules:
+    no-todo: off
+    no-eval: low
+- files: ['*_test.py']
+  rules:
+    no-eval: {severity: medium, args: ['exec(']}
+- files: ['scripts/keep_todo.py']
+  rules:
+    no-todo: high
+`
+
+func TestOverrides(t *testing.T) {
+	cfg, err := pl.LoadConfigFile(severityConfigFile + overridesConfig)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+
+	var tests = []struct {
+		path     string
+		findings []string
+	}{
+		{"example.py", []string{"no-todo:1:low", "no-eval:2:high"}},
+		{"scripts/run.py", []string{"no-eval:2:low"}},
+		{"lib/app_test.py", []string{"no-todo:1:low", "no-eval:3:medium"}},
+		{"scripts/keep_todo.py", []string{"no-todo:1:high", "no-eval:2:low"}},
+		{"scripts/app_test.py", []string{"no-eval:3:medium"}},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result, err := pl.ProcessFile("# TODO\neval(x)\nexec(y)", tt.path, cfg)
+			if err != nil {
+				t.Fatalf("Test #%d Error processing file: %v", idx, err)
+			}
+			var findings []string
+			for _, finding := range result.Findings {
+				findings = append(findings, fmt.Sprintf("%s:%d:%s", finding.RuleId, finding.LineNo, finding.Severity))
+			}
+			if fmt.Sprint(findings) != fmt.Sprint(tt.findings) {
+				t.Errorf("Test #%d Result was incorrect, got: %v, want: %v.", idx, findings, tt.findings)
+			}
+		})
+	}
+
+	// A warm cache reattaches the rules as overridden for the file
+	t.Setenv("HOME", t.TempDir())
+	cache, err := pl.NewResultCache(cfg)
+	if err != nil {
+		t.Fatalf("Error creating cache: %v", err)
+	}
+	content := []byte("# TODO\neval(x)\nexec(y)")
+	for idx, tt := range tests {
+		cold, err := pl.ProcessFile(string(content), tt.path, cfg)
+		if err != nil {
+			t.Fatalf("Test #%d Error processing file: %v", idx, err)
+		}
+		cache.Put(tt.path, content, cold)
+		warm, ok := cache.Get(tt.path, content)
+		if !ok || len(warm.Findings) != len(cold.Findings) {
+			t.Fatalf("Test #%d Cached report was incorrect, got: %v %v, want: %v.", idx, ok, warm.Findings, cold.Findings)
+		}
+		for i, finding := range warm.Findings {
+			if finding.Rule.Severity != cold.Findings[i].Rule.Severity {
+				t.Errorf("Test #%d Cached rule severity was incorrect, got: %s, want: %s.", idx, finding.Rule.Severity, cold.Findings[i].Rule.Severity)
+			}
+		}
+	}
+
+	// Forked workers get the override's function rebuilt too
+	fork, err := cfg.Fork()
+	if err != nil {
+		t.Fatalf("Error forking config: %v", err)
+	}
+	result, err := pl.ProcessFile("exec(y)", "app_test.py", fork)
+	if err != nil || len(result.Findings) != 1 {
+		t.Errorf("Forked overrides were incorrect, got: %v %v.", result.Findings, err)
+	}
+
+	// Named args of an override are merged into the rule's named args
+	cfg, err = pl.LoadConfigFile(builtinConfig("line", "contains", "{pattern: todo}") + `overrides:
+- files: ['docs/**']
+  rules:
+    contains: {args: {ignore_case: true}}
+`)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	for idx, tt := range []struct {
+		path  string
+		count int
+	}{{"main.go", 1}, {"docs/index.md", 2}} {
+		result, err := pl.ProcessFile("TODO todo", tt.path, cfg)
+		if err != nil || len(result.Findings) != tt.count {
+			t.Errorf("Test #%d Merged override args were incorrect, got: %v %v, want %d findings.", idx, result.Findings, err, tt.count)
+		}
+	}
+}
+
+func TestOverrideErrors(t *testing.T) {
+	_, err := pl.LoadConfigFileWithSource(severityConfigFile+`overrides:
+- files: ['*.py']
+  rules:
+    no-such-rule: off
+    no-todo: critical
+- files: []
+  rules:
+    no-eval: {args: [1]}
+`, "overrides.yaml")
+	var configErrs pl.ConfigErrors
+	if !errors.As(err, &configErrs) {
+		t.Fatalf("Expected ConfigErrors, got: %v", err)
+	}
+
+	var tests = []struct {
+		line    int
+		message string
+	}{
+		{23, "override of unknown rule no-such-rule"},
+		{24, "unknown severity level"},
+		{25, "override requires at least one glob in files"},
+		{27, "builtin contains requires args[0] (pattern) to be a string but was int"},
+	}
+	if len(configErrs) != len(tests) {
+		t.Fatalf("Error count was incorrect, got: %d, want: %d.\n%v", len(configErrs), len(tests), err)
+	}
+	for idx, tt := range tests {
+		if configErrs[idx].Line != tt.line || !strings.Contains(configErrs[idx].Err.Error(), tt.message) {
+			t.Errorf("Test #%d Error was incorrect, got: %v, want %q on line %d.", idx, configErrs[idx], tt.message, tt.line)
+		}
+	}
+}
+
+// builtinConfig declares a single builtin rule for every path
+func builtinConfig(scope, name, args string) string {
+	return fmt.Sprintf(`---
+version: v0.0.1
+rules:
+- id: %s
+  severity: low
+  include_paths: '.*'
+  fn:
+    type: builtin
+    scope: %s
+    name: %s
+    args: %s
+`, strings.ReplaceAll(name, "_", "-"), scope, name, args)
+}
+
+func TestBuiltins(t *testing.T) {
+	var tests = []struct {
+		scope    string
+		name     string
+		args     string
+		path     string
+		content  string
+		findings []string
+	}{
+		{"file", "not_contains", "['Copyright']", "a.go", "package a", []string{"0:0"}},
+		{"file", "not_contains", "['Copyright']", "a.go", "// Copyright\npackage a", nil},
+		{"file", "not_regexp", "['(?m)^package \\w+$']", "a.go", "// empty", []string{"0:0"}},
+		{"path", "not_regexp", "['^src/']", "lib/a.go", "", []string{"0:0"}},
+		{"path", "not_contains", "['src/']", "src/a.go", "", nil},
+		{"line", "max_line_length", "[5]", "a.txt", "short\ntoo long\nçççççç", []string{"2:6 Line is 8 characters long, the limit is 5", "3:6 Line is 6 characters long, the limit is 5"}},
+		{"line", "trailing_whitespace", "[]", "a.txt", "ok\ntrailing \t\r\nx", []string{"2:9"}},
+		{"line", "no_tabs", "[]", "a.txt", "\tone\ttwo", []string{"1:1", "1:5"}},
+		{"file", "max_file_lines", "[2]", "a.txt", "1\n2\n", nil},
+		{"file", "max_file_lines", "[2]", "a.txt", "1\n2\n3\n", []string{"3:0 File has 3 lines, the limit is 2"}},
+		{"file", "max_file_size", "[4]", "a.txt", "12345", []string{"0:0 File is 5 bytes, the limit is 4"}},
+		{"file", "must_end_with_newline", "[]", "a.txt", "a\nb", []string{"2:0"}},
+		{"file", "must_end_with_newline", "[]", "a.txt", "", nil},
+		{"file", "required_header", "['// Licensed under MIT']", "a.go", "// Licensed under MIT\npackage a", nil},
+		{"file", "required_header", "['# Licensed under MIT']", "a.sh", "#!/bin/sh\necho", []string{"2:0"}},
+		{"path", "filename_case", "[kebab]", "src/my-file.test.ts", "", nil},
+		{"path", "filename_case", "[kebab]", "src/my_file.ts", "", []string{"0:0 File name my_file.ts isn't kebab case"}},
+		{"path", "filename_case", "[snake]", "src/.eslintrc", "", nil},
+		{"path", "filename_case", "[pascal]", "src/MyComponent.tsx", "", nil},
+		{"path", "forbidden_extension", "[exe, .DLL]", "bin/tool.dll", "", []string{"0:0 Files with the .dll extension aren't allowed"}},
+		{"path", "forbidden_extension", "[exe]", "bin/tool.sh", "", nil},
+		{"path", "forbidden_extension", "{extensions: exe}", "bin/tool.EXE", "", []string{"0:0 Files with the .exe extension aren't allowed"}},
+		{"line", "contains", "{pattern: todo, ignore_case: true}", "a.txt", "# TODO and Todo", []string{"1:3", "1:12"}},
+		{"line", "contains", "todo", "a.txt", "# TODO and todo", []string{"1:12"}},
+		{"line", "contains", "[TODO, a note]", "a.txt", "# TODO and todo", []string{"1:3"}},
+		{"line", "contains", "[todo, true, a note]", "a.txt", "# TODO and todo", []string{"1:3", "1:12"}},
+		{"file", "regexp", "['to+do', 1, 2]", "a.txt", "# TODO and todo", []string{"1:12"}},
+		{"file", "contains", "[TODO]", "a.txt", "a TODO\nTODO TODO\n# polylint disable-next-line=contains\nb TODO", []string{"1:3", "2:1", "2:6"}},
+		{"line", "regexp", "{pattern: 'to+do', ignore_case: true}", "a.txt", "# TOOODO", []string{"1:3"}},
+		{"line", "replace", "{pattern: 'print\\((.*)\\)', replacement: 'log($1)'}", "a.py", "print(x)", []string{"1:1"}},
+		{"line", "max_line_length", "{max: 3}", "a.txt", "four", []string{"1:4 Line is 4 characters long, the limit is 3"}},
+		{"file", "required_header", "{header: '# Licensed under MIT', skip_shebang: false}", "a.sh", "#!/bin/sh\n# Licensed under MIT", []string{"1:0"}},
+		{"path", "not_contains", "{pattern: SRC/, ignore_case: true}", "src/a.go", "", nil},
+		{"line", "contains_any", "[{pattern: master, message: Use main}, slave, {pattern: ast}]", "a.txt", "master slave", []string{"1:1 Use main", "1:2", "1:8"}},
+		{"line", "contains_any", "{patterns: [foo, {pattern: BAR, message: No bar}], ignore_case: true}", "a.txt", "bar FOO", []string{"1:1 No bar", "1:5"}},
+		{"file", "regexp_any", "[{pattern: 'v(\\d)+', message: Versioned}, {pattern: '\\bTODO\\b', message: Todo}]", "a.txt", "TODO\nv12", []string{"1:1 Todo", "2:1 Versioned"}},
+		{"path", "regexp_any", "[{pattern: '\\.bak$', message: Backup file}, '~$']", "a.txt.bak", "", []string{"0:0 Backup file"}},
+		{"path", "contains_any", "[tmp/, cache/]", "src/a.go", "", nil},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := pl.LoadConfigFile(builtinConfig(tt.scope, tt.name, tt.args))
+			if err != nil {
+				t.Fatalf("Test #%d Error loading config file: %v", idx, err)
+			}
+			result, err := pl.ProcessFile(tt.content, tt.path, cfg)
+			if err != nil {
+				t.Fatalf("Test #%d Error processing file: %v", idx, err)
+			}
+			var findings []string
+			for _, finding := range result.Findings {
+				found := fmt.Sprintf("%d:%d", finding.LineNo, finding.StartColumn)
+				if finding.Message != finding.Rule.Recommendation {
+					found += " " + finding.Message
+				}
+				findings = append(findings, found)
+			}
+			if fmt.Sprint(findings) != fmt.Sprint(tt.findings) {
+				t.Errorf("Test #%d Result was incorrect, got: %q, want: %q.", idx, findings, tt.findings)
+			}
+		})
+	}
+}
+
+func TestBuiltinArgErrors(t *testing.T) {
+	var tests = []struct {
+		scope   string
+		name    string
+		args    string
+		message string
+	}{
+		{"line", "max_line_length", "['80']", "builtin max_line_length requires args[0] (max) to be an integer but was string"},
+		{"file", "max_file_lines", "[0]", "builtin max_file_lines requires args[0] (max) to be at least 1 but was 0"},
+		{"file", "max_file_size", "[]", "builtin max_file_size requires max"},
+		{"line", "no_tabs", "[2]", "builtin no_tabs doesn't take args"},
+		{"path", "filename_case", "[upper]", `builtin filename_case requires args[0] (case) to be one of camel, kebab, pascal, snake but was "upper"`},
+		{"path", "forbidden_extension", "[]", "builtin forbidden_extension requires extensions"},
+		{"file", "required_header", "['']", "builtin required_header requires a non empty header"},
+		{"file", "not_regexp", "['(']", "builtin not_regexp requires args[0] (pattern) to be a valid regexp"},
+		{"line", "max_file_size", "[10]", "builtin max_file_size is only available for file scope"},
+		{"path", "no_such_builtin", "[]", "unknown builtin no_such_builtin"},
+		{"line", "contains", "{pattern: TODO, ignorecase: true}", "builtin contains has unknown args ignorecase, expected pattern, ignore_case"},
+		{"line", "contains", "{pattern: TODO, ignore_case: 'yes'}", "builtin contains requires ignore_case to be a boolean but was string"},
+		{"line", "replace", "[a, b, true, extra]", "builtin replace takes at most 3 positional args, pattern, replacement, ignore_case"},
+		{"line", "contains_any", "[TODO, true, extra]", "builtin contains_any requires args[0:] (patterns) to be a list of patterns but entry 1 was bool"},
+		{"line", "max_line_length", "{max: 80.5}", "builtin max_line_length requires max to be an integer but was float64"},
+		{"path", "forbidden_extension", "{extensions: [exe, 1]}", "builtin forbidden_extension requires extensions to be a list of strings but entry 1 was int"},
+		{"file", "replace", "{pattern: x}", "builtin replace requires replacement"},
+		{"line", "contains_any", "{patterns: []}", "builtin contains_any requires patterns to be a list of patterns with at least one entry"},
+		{"line", "contains_any", "[{message: x}]", "builtin contains_any requires args[0:] (patterns) to be a list of patterns but entry 0 has no pattern"},
+		{"line", "contains_any", "{patterns: [{pattern: a, msg: x}]}", "builtin contains_any requires patterns to be a list of patterns but entry 0 has the unknown key msg"},
+		{"line", "contains_any", "['']", "builtin contains_any requires patterns[0] to be non empty"},
+		{"file", "regexp_any", "[a, '(']", "builtin regexp_any requires patterns[1] to be a valid regexp"},
+		{"file", "json_path", "{path: $.name, assert: equals}", "builtin json_path requires a value to assert equals"},
+		{"file", "yaml_path", "[$.name, exists, x]", "builtin yaml_path doesn't take a value to assert exists"},
+		{"file", "toml_path", "[$.name, matches, 1]", "builtin toml_path requires value to be a regexp but was int"},
+		{"file", "yaml_path", "['a[']", `builtin yaml_path requires path to be a valid path: missing ] at "["`},
+		{"file", "json_path", "['$[']", `builtin json_path requires path to be a valid path: missing ] at "["`},
+		{"file", "json_path", "['$[\"']", `builtin json_path requires path to be a valid path: missing ] at "[\""`},
+		{"file", "yaml_path", "['$.spec[x]']", `builtin yaml_path requires path to be a valid path: "x" isn't an index, quote names like ["name"]`},
+		{"file", "yaml_path", "{path: $.a, assert: has}", `builtin yaml_path requires assert to be one of absent, equals, exists, matches but was "has"`},
+		{"file", "regexp_multiline", "[a, true, true]", "builtin regexp_multiline takes at most 2 positional args, pattern, ignore_case"},
+		{"line", "regexp_multiline", "[a]", "builtin regexp_multiline is only available for file scope"},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pl.LoadConfigFile(builtinConfig(tt.scope, tt.name, tt.args))
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Test #%d Error was incorrect, got: %v, want: %q.", idx, err, tt.message)
+			}
+		})
+	}
+}
+
+func TestMergedContainsRules(t *testing.T) {
+	// Literal contains rules are merged into one automaton while regexp rules run alone, so
+	// the same patterns quoted as regexps must report the same findings
+	patterns := []string{"he", "she", "his", "hers", "TODO", "TO", "DO", "aaa", "é"}
+	var containsRules, regexpRules strings.Builder
+	for idx, pattern := range patterns {
+		rule := fmt.Sprintf("- id: rule-%d\n  severity: low\n  include_paths: '.*'\n  fn: {type: builtin, scope: %s, name: %%s, args: [%%q]}\n", idx, []string{"line", "file"}[idx%2])
+		fmt.Fprintf(&containsRules, rule, "contains", pattern)
+		fmt.Fprintf(&regexpRules, rule, "regexp", regexp.QuoteMeta(pattern))
+	}
+
+	content := "ushers TODO his\naaaaaaa héhe\nDOTODO shers"
+	var results [2][]string
+	for idx, rules := range []string{containsRules.String(), regexpRules.String()} {
+		cfg, err := pl.LoadConfigFile("---\nversion: v0.0.1\nrules:\n" + rules)
+		if err != nil {
+			t.Fatalf("Test #%d Error loading config file: %v", idx, err)
+		}
+		result, err := pl.ProcessFile(content, "example.txt", cfg)
+		if err != nil {
+			t.Fatalf("Test #%d Error processing file: %v", idx, err)
+		}
+		for _, finding := range result.Findings {
+			results[idx] = append(results[idx], fmt.Sprintf("%s:%d:%d-%d", finding.RuleId, finding.LineNo, finding.Range.Start, finding.Range.End))
+		}
+	}
+	if len(results[0]) == 0 || fmt.Sprint(results[0]) != fmt.Sprint(results[1]) {
+		t.Errorf("Merged findings were incorrect, got: %v, want: %v.", results[0], results[1])
+	}
+}
+
+func TestRegexpMultiline(t *testing.T) {
+	content := "try:\n    run()\nexcept:\n    pass\n\nexcept:\n    log()\n"
+	var tests = []struct {
+		args     string
+		content  string
+		findings []string
+	}{
+		{"['^except:\\s*\\n\\s*pass$']", content, []string{"3:1-4:9"}},
+		{"{pattern: 'try:.*pass', dot_all: true}", content, []string{"1:1-4:9"}},
+		{"['try:.*pass']", content, nil},
+		{"{pattern: '^\\s*PASS$', ignore_case: true, multiline: false}", content, nil},
+		{"['run\\(\\)']", content, []string{"2:5-2:10"}},
+		{"['é+\\n+b']", "aé\n\nb", []string{"1:2-3:2"}},
+	}
+	for idx, tt := range tests {
+		cfg, err := pl.LoadConfigFile(builtinConfig("file", "regexp_multiline", tt.args))
+		if err != nil {
+			t.Fatalf("Test #%d Error loading config file: %v", idx, err)
+		}
+		result, err := pl.ProcessFile(tt.content, "example.py", cfg)
+		if err != nil {
+			t.Fatalf("Test #%d Error processing file: %v", idx, err)
+		}
+		var findings []string
+		for _, finding := range result.Findings {
+			endLineNo := finding.EndLineNo
+			if endLineNo == 0 {
+				endLineNo = finding.LineNo
+			}
+			findings = append(findings, fmt.Sprintf("%d:%d-%d:%d", finding.LineNo, finding.StartColumn, endLineNo, finding.EndColumn))
+		}
+		if fmt.Sprint(findings) != fmt.Sprint(tt.findings) {
+			t.Errorf("Test #%d Result was incorrect, got: %v, want: %v.", idx, findings, tt.findings)
+		}
+	}
+}
+
+func TestDataPathBuiltins(t *testing.T) {
+	manifest := `apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: 1
+  containers:
+  - name: web
+    image: registry.corp/web:1.2
+    resources: {limits: {cpu: 1}}
+  - name: sidecar
+    image: nginx:latest
+---
+kind: Service
+`
+	packageJSON := `{
+  "name": "app",
+  "private": true,
+  "engines": {"node": ">=16"},
+  "scripts": {
+    "test": "jest",
+    "build.prod": "tsc"
+  },
+  "files": ["dist", "lib"]
+}`
+	cargo := `[package]
+name = "app"
+edition = "2018"
+
+[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+
+[[bin]]
+name = "cli"
+
+[[bin]]
+name = "server"
+path = "src/server.rs"
+`
+	var tests = []struct {
+		name     string
+		args     string
+		content  string
+		findings []string
+	}{
+		{"yaml_path", "['spec.containers[*].resources']", manifest, []string{"9:5 $.spec.containers[1].resources is missing", "12:1 $.spec is missing"}},
+		{"yaml_path", "['$.spec.containers[*].image', matches, '^registry\\.corp/']", manifest, []string{"10:12 $.spec.containers[1].image is \"nginx:latest\", which doesn't match ^registry\\.corp/"}},
+		{"yaml_path", "{path: $.kind, assert: equals, value: Deployment}", manifest, []string{"12:7 $.kind is \"Service\", expected \"Deployment\""}},
+		{"yaml_path", "{path: $.spec.replicas, assert: equals, value: 1}", manifest, nil},
+		{"yaml_path", "{path: '$..cpu', assert: absent}", manifest, []string{"8:31 $.spec.containers[0].resources.limits.cpu is present"}},
+		{"yaml_path", "['$.spec']", manifest, []string{"12:1 $.spec is missing"}},
+		{"yaml_path", "['$.spec']", "", []string{"0:0 $.spec is missing"}},
+		{"yaml_path", "['$.spec']", "a: [", []string{"0:0 File isn't valid YAML: yaml: line 1: did not find expected node content"}},
+		{"yaml_path", "['$.a.b']", "base: &b {b: 1, c: 2}\na: {<<: *b}\n", nil},
+		{"yaml_path", "{path: $.a.c, assert: equals, value: 3}", "base: &b {b: 1, c: 2}\nother: &o {c: 4}\na:\n  c: 3\n  <<: [*o, *b]\n", nil},
+		{"yaml_path", "{path: $.a.c, assert: equals, value: 4}", "base: &b {b: 1, c: 2}\nother: &o {c: 4}\na:\n  <<: [*o, *b]\n", nil},
+		{"yaml_path", "{path: '$.a[\"<<\"]', assert: absent}", "base: &b {b: 1}\na: {<<: *b}\n", nil},
+		{"json_path", "{path: $.private, assert: equals, value: true}", packageJSON, nil},
+		{"json_path", "{path: $.engines.node, assert: equals, value: '>=18'}", packageJSON, []string{"4:23 $.engines.node is \">=16\", expected \">=18\""}},
+		{"json_path", "['$.scripts.lint']", packageJSON, []string{"5:14 $.scripts.lint is missing"}},
+		{"json_path", "{path: '$.scripts[\"build.prod\"]', assert: absent}", packageJSON, []string{"7:19 $.scripts[\"build.prod\"] is present"}},
+		{"json_path", "{path: '$.files', assert: equals, value: [dist]}", packageJSON, []string{"9:12 $.files is [\"dist\",\"lib\"], expected [\"dist\"]"}},
+		{"json_path", "{path: '$.files[1]', assert: matches, value: '^d'}", packageJSON, []string{"9:21 $.files[1] is \"lib\", which doesn't match ^d"}},
+		{"json_path", "['$.name']", "{\"name\": 1} {}", []string{"0:0 File isn't valid JSON: unexpected content after the top level value"}},
+		{"toml_path", "{path: $.package.edition, assert: equals, value: '2021'}", cargo, []string{"3:1 $.package.edition is \"2018\", expected \"2021\""}},
+		{"toml_path", "['$.bin[*].path']", cargo, []string{"8:3 $.bin[0].path is missing"}},
+		{"toml_path", "{path: '$.dependencies.serde.features', assert: equals, value: [derive]}", cargo, nil},
+		{"toml_path", "{path: '$..version', assert: matches, value: '^2'}", cargo, []string{"6:11 $.dependencies.serde.version is \"1.0\", which doesn't match ^2"}},
+		{"toml_path", "{path: '$.bin[1].name', assert: absent}", cargo, []string{"12:1 $.bin[1].name is present"}},
+		{"toml_path", "{path: '$.fruits[*].varieties[*].name', assert: matches, value: '^[a-z ]+$'}", "[[fruits]]\nname = \"apple\"\n\n[[fruits.varieties]]\nname = \"Red\"\n\n[[fruits]]\n[[fruits.varieties]]\nname = \"plantain\"\n", []string{"5:1 $.fruits[0].varieties[0].name is \"Red\", which doesn't match ^[a-z ]+$"}},
+	}
+	for idx, tt := range tests {
+		cfg, err := pl.LoadConfigFile(builtinConfig("file", tt.name, tt.args))
+		if err != nil {
+			t.Fatalf("Test #%d Error loading config file: %v", idx, err)
+		}
+		result, err := pl.ProcessFile(tt.content, "example", cfg)
+		if err != nil {
+			t.Fatalf("Test #%d Error processing file: %v", idx, err)
+		}
+		var findings []string
+		for _, finding := range result.Findings {
+			findings = append(findings, fmt.Sprintf("%d:%d %s", finding.LineNo, finding.StartColumn, finding.Message))
+		}
+		if fmt.Sprint(findings) != fmt.Sprint(tt.findings) {
+			t.Errorf("Test #%d Result was incorrect, got: %v, want: %v.", idx, findings, tt.findings)
+		}
+	}
+}
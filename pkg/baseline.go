@@ -0,0 +1,163 @@
+package polylint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+const baselineVersion = 1
+
+// BaselineEntry identifies findings by rule, path and a fingerprint of the offending content
+// rather than a line number, so that edits elsewhere in the file don't invalidate it
+type BaselineEntry struct {
+	RuleId      string `json:"rule_id"`
+	Path        string `json:"path"`
+	Fingerprint string `json:"fingerprint"`
+	// Count is the number of identical findings suppressed by this entry
+	Count int `json:"count"`
+}
+
+func (e BaselineEntry) key() string {
+	return e.RuleId + "\x00" + e.Path + "\x00" + e.Fingerprint
+}
+
+// Baseline is a set of pre-existing findings that are not reported again
+type Baseline struct {
+	Version int             `json:"version"`
+	Entries []BaselineEntry `json:"entries"`
+}
+
+// Fingerprint hashes the content a finding points at. Whitespace at either end of the line is
+// ignored so re-indenting code doesn't invalidate the baseline.
+func Fingerprint(finding Finding) string {
+	switch {
+	case finding.LineNo > 0:
+		return SHA256(strings.TrimSpace(finding.Line))
+	case finding.Range != nil && finding.Range.End <= len(finding.Line):
+		return SHA256(finding.Line[finding.Range.Start:finding.Range.End])
+	default:
+		// Path scoped findings and file scoped findings without a location
+		return ""
+	}
+}
+
+func baselineEntryFor(finding Finding) BaselineEntry {
+	return BaselineEntry{
+		RuleId:      finding.RuleId,
+		Path:        filepath.ToSlash(finding.Path),
+		Fingerprint: Fingerprint(finding),
+		Count:       1,
+	}
+}
+
+// NewBaseline records every finding in the reports
+func NewBaseline(reports []FileReport) Baseline {
+	counts := make(map[string]*BaselineEntry)
+	var keys []string
+	for _, report := range reports {
+		for _, finding := range report.Findings {
+			entry := baselineEntryFor(finding)
+			if existing, ok := counts[entry.key()]; ok {
+				existing.Count++
+				continue
+			}
+			counts[entry.key()] = &entry
+			keys = append(keys, entry.key())
+		}
+	}
+	sort.Strings(keys)
+
+	baseline := Baseline{Version: baselineVersion, Entries: []BaselineEntry{}}
+	for _, key := range keys {
+		baseline.Entries = append(baseline.Entries, *counts[key])
+	}
+	return baseline
+}
+
+func LoadBaseline(path string) (Baseline, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Baseline{}, fmt.Errorf("error reading baseline %q: %v", path, err)
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(content, &baseline); err != nil {
+		return Baseline{}, fmt.Errorf("error parsing baseline %q: %v", path, err)
+	}
+	if baseline.Version != baselineVersion {
+		return Baseline{}, fmt.Errorf("unsupported baseline version %d in %q", baseline.Version, path)
+	}
+	return baseline, nil
+}
+
+func (b Baseline) Write(path string) error {
+	content, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// Filter drops findings recorded in the baseline and returns the remaining reports along with
+// stale entries, which no longer match anything in a file that was linted or that was deleted
+func (b Baseline) Filter(reports []FileReport) ([]FileReport, []BaselineEntry) {
+	remaining := make(map[string]int, len(b.Entries))
+	for _, entry := range b.Entries {
+		remaining[entry.key()] += entry.Count
+	}
+
+	linted := make(map[string]bool, len(reports))
+	filtered := make([]FileReport, len(reports))
+	for idx, report := range reports {
+		linted[filepath.ToSlash(report.Path)] = true
+		report.Findings = nil
+		for _, finding := range reports[idx].Findings {
+			key := baselineEntryFor(finding).key()
+			if remaining[key] > 0 {
+				remaining[key]--
+				continue
+			}
+			report.Findings = append(report.Findings, finding)
+		}
+		filtered[idx] = report
+	}
+
+	var stale []BaselineEntry
+	for _, entry := range b.Entries {
+		count := remaining[entry.key()]
+		if count == 0 {
+			continue
+		}
+		if _, err := os.Stat(filepath.FromSlash(entry.Path)); linted[entry.Path] || os.IsNotExist(err) {
+			entry.Count = count
+			stale = append(stale, entry)
+		}
+		// Entries are keyed uniquely, clear the count so duplicates aren't reported twice
+		remaining[entry.key()] = 0
+	}
+	return filtered, stale
+}
+
+// StaleBaselineReporter renders baseline entries that no longer match any finding
+type StaleBaselineReporter struct{}
+
+func (StaleBaselineReporter) Report(w io.Writer, stale []BaselineEntry) error {
+	if len(stale) == 0 {
+		return nil
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.SetTitle("Stale baseline entries")
+	t.AppendHeader(table.Row{"File", "Rule Id", "Count"})
+	for _, entry := range stale {
+		t.AppendRow([]interface{}{entry.Path, entry.RuleId, entry.Count})
+	}
+	t.Render()
+	return nil
+}
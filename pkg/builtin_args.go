@@ -0,0 +1,272 @@
+package polylint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type argType string
+
+const (
+	stringArgType     argType = "a string"
+	regexpArgType     argType = "a regexp"
+	intArgType        argType = "an integer"
+	boolArgType       argType = "a boolean"
+	stringListArgType argType = "a list of strings"
+	// patternListArgType is a list of patterns, each a string or a mapping of pattern and message
+	patternListArgType argType = "a list of patterns"
+	// anyArgType is any yaml value, left for the builtin to check
+	anyArgType argType = "any value"
+)
+
+// argSpec declares an arg of a builtin. Positional args fill the specs in order, and a list
+// as the last spec collects the remaining positional args.
+type argSpec struct {
+	Name     string
+	Type     argType
+	Required bool
+	// Default is used when an optional arg isn't given
+	Default any
+	// Min is the smallest value allowed for integer args
+	Min int
+	// OneOf lists the values allowed for string args
+	OneOf []string
+	// NamedOnly args can't be given positionally
+	NamedOnly bool
+}
+
+// patternArg is one entry of a patternListArgType arg
+type patternArg struct {
+	Pattern string
+	// Message replaces the rule's recommendation for matches of this pattern
+	Message string
+}
+
+// builtinArgs are the validated args of a builtin by name, holding string, *regexp.Regexp,
+// int, bool, []string, []patternArg or decoded yaml values as declared by their specs
+type builtinArgs map[string]any
+
+func (a builtinArgs) string(name string) string {
+	value, _ := a[name].(string)
+	return value
+}
+
+func (a builtinArgs) regexp(name string) *regexp.Regexp {
+	value, _ := a[name].(*regexp.Regexp)
+	return value
+}
+
+func (a builtinArgs) int(name string) int {
+	value, _ := a[name].(int)
+	return value
+}
+
+func (a builtinArgs) bool(name string) bool {
+	value, _ := a[name].(bool)
+	return value
+}
+
+func (a builtinArgs) strings(name string) []string {
+	value, _ := a[name].([]string)
+	return value
+}
+
+func (a builtinArgs) patterns(name string) []patternArg {
+	value, _ := a[name].([]patternArg)
+	return value
+}
+
+// resolveArgs checks the args of f against the specs of its builtin, naming positional args and
+// applying defaults
+func resolveArgs(f RawFn, specs []argSpec) (builtinArgs, error) {
+	given := make(map[string]any, len(specs))
+	labels := make(map[string]string, len(specs))
+	for name, value := range f.Args.Named {
+		given[name] = value
+		labels[name] = name
+	}
+	if len(f.Args.Named) > 0 {
+		var unknown []string
+		for name := range f.Args.Named {
+			if !hasSpec(specs, name) {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return nil, fnErrorf("args", "builtin %s has unknown args %s, expected %s", f.Name, strings.Join(unknown, ", "), specNames(specs))
+		}
+	}
+	var positional []argSpec
+	for _, spec := range specs {
+		if !spec.NamedOnly {
+			positional = append(positional, spec)
+		}
+	}
+	for idx, value := range f.Args.Positional {
+		if idx >= len(positional) {
+			if len(specs) == 0 {
+				return nil, fnErrorf("args", "builtin %s doesn't take args", f.Name)
+			}
+			return nil, fnErrorf("args", "builtin %s takes at most %d positional args, %s", f.Name, len(positional), specNames(positional))
+		}
+		spec := positional[idx]
+		if (spec.Type == stringListArgType || spec.Type == patternListArgType) && idx == len(positional)-1 {
+			given[spec.Name] = f.Args.Positional[idx:]
+			labels[spec.Name] = fmt.Sprintf("args[%d:] (%s)", idx, spec.Name)
+			break
+		}
+		given[spec.Name] = value
+		labels[spec.Name] = fmt.Sprintf("args[%d] (%s)", idx, spec.Name)
+	}
+
+	args := make(builtinArgs, len(specs))
+	for _, spec := range specs {
+		value, ok := given[spec.Name]
+		if !ok {
+			if spec.Required {
+				return nil, fnErrorf("args", "builtin %s requires %s", f.Name, spec.Name)
+			}
+			// Args without a default are left out so builtins can tell they weren't given
+			if spec.Default != nil {
+				args[spec.Name] = spec.Default
+			}
+			continue
+		}
+		converted, err := convertArg(spec, value)
+		if err != nil {
+			return nil, fnErrorf("args", "builtin %s requires %s to be %v", f.Name, labels[spec.Name], err)
+		}
+		args[spec.Name] = converted
+	}
+	return args, nil
+}
+
+func hasSpec(specs []argSpec, name string) bool {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func specNames(specs []argSpec) string {
+	if len(specs) == 0 {
+		return "none"
+	}
+	names := make([]string, len(specs))
+	for idx, spec := range specs {
+		names[idx] = spec.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// convertArg checks the type of a decoded yaml value, returning an error that completes the
+// sentence "requires <arg> to be"
+func convertArg(spec argSpec, value any) (any, error) {
+	switch spec.Type {
+	case stringArgType, regexpArgType:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s but was %T", spec.Type, value)
+		}
+		if len(spec.OneOf) > 0 && !containsString(spec.OneOf, s) {
+			return nil, fmt.Errorf("one of %s but was %q", strings.Join(spec.OneOf, ", "), s)
+		}
+		if spec.Type == stringArgType {
+			return s, nil
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("a valid regexp: %v", err)
+		}
+		return re, nil
+	case intArgType:
+		n, ok := value.(int)
+		if !ok {
+			return nil, fmt.Errorf("%s but was %T", spec.Type, value)
+		}
+		if n < spec.Min {
+			return nil, fmt.Errorf("at least %d but was %d", spec.Min, n)
+		}
+		return n, nil
+	case boolArgType:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s but was %T", spec.Type, value)
+		}
+		return b, nil
+	case stringListArgType:
+		// A single string is a list of one
+		if s, ok := value.(string); ok {
+			value = []any{s}
+		}
+		list, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s but was %T", spec.Type, value)
+		}
+		if len(list) == 0 && spec.Required {
+			return nil, fmt.Errorf("%s with at least one entry", spec.Type)
+		}
+		values := make([]string, len(list))
+		for idx, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s but entry %d was %T", spec.Type, idx, item)
+			}
+			values[idx] = s
+		}
+		return values, nil
+	case patternListArgType:
+		list, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s but was %T", spec.Type, value)
+		}
+		if len(list) == 0 && spec.Required {
+			return nil, fmt.Errorf("%s with at least one entry", spec.Type)
+		}
+		patterns := make([]patternArg, len(list))
+		for idx, item := range list {
+			switch item := item.(type) {
+			case string:
+				patterns[idx] = patternArg{Pattern: item}
+			case map[any]any:
+				if _, ok := item["pattern"]; !ok {
+					return nil, fmt.Errorf("%s but entry %d has no pattern", spec.Type, idx)
+				}
+				for key, v := range item {
+					text, ok := v.(string)
+					switch {
+					case key != "pattern" && key != "message":
+						return nil, fmt.Errorf("%s but entry %d has the unknown key %v", spec.Type, idx, key)
+					case !ok:
+						return nil, fmt.Errorf("%s but the %v of entry %d was %T", spec.Type, key, idx, v)
+					case key == "pattern":
+						patterns[idx].Pattern = text
+					default:
+						patterns[idx].Message = text
+					}
+				}
+			default:
+				return nil, fmt.Errorf("%s but entry %d was %T", spec.Type, idx, item)
+			}
+		}
+		return patterns, nil
+	case anyArgType:
+		return value, nil
+	default:
+		return nil, fmt.Errorf("of unknown type %s", spec.Type)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,586 @@
+package polylint
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// builtin is a rule function implemented in go along with the schema of its args
+type builtin struct {
+	args []argSpec
+	// build is called with args already checked against the schema
+	build func(f RawFn, args builtinArgs) (RuleFunc, error)
+}
+
+var (
+	containsArgs = []argSpec{
+		{Name: "pattern", Type: stringArgType, Required: true},
+		{Name: "ignore_case", Type: boolArgType, Default: false},
+	}
+	regexpArgs = []argSpec{
+		{Name: "pattern", Type: regexpArgType, Required: true},
+		{Name: "ignore_case", Type: boolArgType, Default: false},
+	}
+	replaceArgs = []argSpec{
+		{Name: "pattern", Type: regexpArgType, Required: true},
+		{Name: "replacement", Type: stringArgType, Required: true},
+		{Name: "ignore_case", Type: boolArgType, Default: false},
+	}
+	maxArgs = []argSpec{{Name: "max", Type: intArgType, Required: true, Min: 1}}
+	// anyArgs collect every positional arg as a pattern
+	anyArgs = []argSpec{
+		{Name: "patterns", Type: patternListArgType, Required: true},
+		{Name: "ignore_case", Type: boolArgType, Default: false, NamedOnly: true},
+	}
+)
+
+// builtins are the builtin rule functions available in each scope, keyed by name
+var builtins = map[Scope]map[string]builtin{
+	lineScope: {
+		"contains":            {containsArgs, buildMatchesFn},
+		"regexp":              {regexpArgs, buildMatchesFn},
+		"replace":             {replaceArgs, buildReplaceFn},
+		"contains_any":        {anyArgs, buildAnyMatchesFn},
+		"regexp_any":          {anyArgs, buildAnyMatchesFn},
+		"max_line_length":     {maxArgs, buildMaxLineLengthFn},
+		"trailing_whitespace": {nil, buildTrailingWhitespaceFn},
+		"no_tabs":             {nil, buildNoTabsFn},
+	},
+	fileScope: {
+		"contains":     {containsArgs, buildMatchesFn},
+		"regexp":       {regexpArgs, buildMatchesFn},
+		"replace":      {replaceArgs, buildReplaceFn},
+		"contains_any": {anyArgs, buildAnyMatchesFn},
+		"regexp_any":   {anyArgs, buildAnyMatchesFn},
+		"regexp_multiline": {[]argSpec{
+			{Name: "pattern", Type: regexpArgType, Required: true},
+			{Name: "ignore_case", Type: boolArgType, Default: false},
+			{Name: "dot_all", Type: boolArgType, Default: false, NamedOnly: true},
+			{Name: "multiline", Type: boolArgType, Default: true, NamedOnly: true},
+		}, buildRegexpMultilineFn},
+		"not_contains":          {containsArgs, buildNotFoundFn},
+		"not_regexp":            {regexpArgs, buildNotFoundFn},
+		"max_file_lines":        {maxArgs, buildMaxFileLinesFn},
+		"max_file_size":         {maxArgs, buildMaxFileSizeFn},
+		"must_end_with_newline": {nil, buildMustEndWithNewlineFn},
+		"required_header": {[]argSpec{
+			{Name: "header", Type: stringArgType, Required: true},
+			{Name: "skip_shebang", Type: boolArgType, Default: true},
+		}, buildRequiredHeaderFn},
+		"json_path": {dataPathArgs, buildDataPathFn},
+		"yaml_path": {dataPathArgs, buildDataPathFn},
+		"toml_path": {dataPathArgs, buildDataPathFn},
+	},
+	pathScope: {
+		"contains":     {containsArgs, buildPathFoundFn},
+		"regexp":       {regexpArgs, buildPathFoundFn},
+		"not_contains": {containsArgs, buildPathNotFoundFn},
+		"not_regexp":   {regexpArgs, buildPathNotFoundFn},
+		"contains_any": {anyArgs, buildPathAnyFn},
+		"regexp_any":   {anyArgs, buildPathAnyFn},
+		"filename_case": {[]argSpec{
+			{Name: "case", Type: stringArgType, Required: true, OneOf: []string{"camel", "kebab", "pascal", "snake"}},
+		}, buildFilenameCaseFn},
+		"forbidden_extension": {[]argSpec{
+			{Name: "extensions", Type: stringListArgType, Required: true},
+		}, buildForbiddenExtensionFn},
+	},
+}
+
+// buildBuiltin looks up the builtin named by f for its scope and checks its args
+func buildBuiltin(f RawFn) (RuleFunc, error) {
+	b, ok := builtins[f.Scope][f.Name]
+	if !ok {
+		var scopes []string
+		for scope, fns := range builtins {
+			if _, ok := fns[f.Name]; ok {
+				scopes = append(scopes, string(scope))
+			}
+		}
+		if len(scopes) > 0 {
+			sort.Strings(scopes)
+			return nil, fnErrorf("name", "builtin %s is only available for %s scope", f.Name, strings.Join(scopes, " or "))
+		}
+		return nil, fnErrorf("name", "unknown builtin %s", f.Name)
+	}
+	f, ignored := withoutLegacyArgs(f)
+	if len(ignored) > 0 {
+		warnOnce(fmt.Sprintf("builtin %s %q ignores the extra args %v", f.Name, f.Args.Positional[0], ignored))
+	}
+	args, err := resolveArgs(f, b.args)
+	if err != nil {
+		return nil, err
+	}
+	return b.build(f, args)
+}
+
+// withoutLegacyArgs drops the positional args after the pattern of contains and regexp that
+// aren't ignore_case. Those builtins only read their first arg before they had a schema, so
+// older configs may have anything after it.
+func withoutLegacyArgs(f RawFn) (RawFn, []any) {
+	if (f.Name != "contains" && f.Name != "regexp") || len(f.Args.Positional) < 2 {
+		return f, nil
+	}
+	keep := 1
+	if _, ok := f.Args.Positional[1].(bool); ok {
+		keep = 2
+	}
+	if keep == len(f.Args.Positional) {
+		return f, nil
+	}
+	ignored := f.Args.Positional[keep:]
+	f.Args.Positional = append([]any{}, f.Args.Positional[:keep]...)
+	return f, ignored
+}
+
+var warned sync.Map
+
+// warnOnce logs a warning the first time it is seen, since forked configs build every rule again
+func warnOnce(message string) {
+	if _, seen := warned.LoadOrStore(message, true); !seen {
+		logz.Warnf("WARNING: %s", message)
+	}
+}
+
+// matched converts a boolean rule result into a single Match without a fix
+func matched(ok bool) []Match {
+	if ok {
+		return []Match{{}}
+	}
+	return nil
+}
+
+// containsMatches returns one Match per non-overlapping occurrence of substr
+func containsMatches(text, substr string) []Match {
+	var matches []Match
+	if substr == "" {
+		return matched(true)
+	}
+	for offset := 0; ; {
+		idx := strings.Index(text[offset:], substr)
+		if idx < 0 {
+			return matches
+		}
+		start := offset + idx
+		matches = append(matches, Match{Range: &Range{Start: start, End: start + len(substr)}})
+		offset = start + len(substr)
+	}
+}
+
+// regexpMatches returns one Match per non-overlapping match of re
+func regexpMatches(text string, re *regexp.Regexp) []Match {
+	var matches []Match
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		matches = append(matches, Match{Range: &Range{Start: loc[0], End: loc[1]}})
+	}
+	return matches
+}
+
+// patternMatcher finds the pattern arg of the contains and regexp builtins. Text patterns
+// that ignore case are matched as a quoted regexp.
+type patternMatcher struct {
+	text string
+	re   *regexp.Regexp
+}
+
+func newPatternMatcher(args builtinArgs) patternMatcher {
+	re := args.regexp("pattern")
+	if re == nil {
+		text := args.string("pattern")
+		if !args.bool("ignore_case") || text == "" {
+			return patternMatcher{text: text}
+		}
+		re = regexp.MustCompile(regexp.QuoteMeta(text))
+	}
+	if args.bool("ignore_case") {
+		re = regexp.MustCompile("(?i)" + re.String())
+	}
+	return patternMatcher{re: re}
+}
+
+func (m patternMatcher) matches(text string) []Match {
+	if m.re != nil {
+		return regexpMatches(text, m.re)
+	}
+	return containsMatches(text, m.text)
+}
+
+func (m patternMatcher) found(text string) bool {
+	if m.re != nil {
+		return m.re.MatchString(text)
+	}
+	return strings.Contains(text, m.text)
+}
+
+func buildMatchesFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	m := newPatternMatcher(args)
+	return func(_path string, _idx int, text string) []Match {
+		return m.matches(text)
+	}, nil
+}
+
+// buildNotFoundFn requires the file to contain the pattern
+func buildNotFoundFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	m := newPatternMatcher(args)
+	return func(_path string, _idx int, file string) []Match {
+		return matched(!m.found(file))
+	}, nil
+}
+
+func buildPathFoundFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	m := newPatternMatcher(args)
+	return func(path string, _idx int, _file string) []Match {
+		return matched(m.found(path))
+	}, nil
+}
+
+// buildPathNotFoundFn requires the path to contain the pattern
+func buildPathNotFoundFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	m := newPatternMatcher(args)
+	return func(path string, _idx int, _file string) []Match {
+		return matched(!m.found(path))
+	}, nil
+}
+
+// anyMatcher finds any of a list of patterns in a single pass and reports the message of the
+// pattern that matched. Literal patterns use a literalMatcher, regexps and literals that ignore
+// case are combined into one regexp with a capture group around each pattern.
+type anyMatcher struct {
+	messages []string
+	literals *literalMatcher
+	re       *regexp.Regexp
+	// groups is the capture group of each pattern in re
+	groups []int
+}
+
+func newAnyMatcher(f RawFn, args builtinArgs) (*anyMatcher, error) {
+	patterns := args.patterns("patterns")
+	m := &anyMatcher{}
+	isRegexp := f.Name == "regexp_any"
+	if !isRegexp && !args.bool("ignore_case") {
+		texts := make([]string, len(patterns))
+		for idx, p := range patterns {
+			if p.Pattern == "" {
+				return nil, fnErrorf("args", "builtin %s requires patterns[%d] to be non empty", f.Name, idx)
+			}
+			texts[idx] = p.Pattern
+		}
+		m.literals = newLiteralMatcher(texts)
+		// Duplicate patterns keep the message of their first entry
+		m.messages = make([]string, len(m.literals.patterns))
+		for idx := len(patterns) - 1; idx >= 0; idx-- {
+			patternIdx, _ := m.literals.index(patterns[idx].Pattern)
+			m.messages[patternIdx] = patterns[idx].Message
+		}
+		return m, nil
+	}
+
+	var combined strings.Builder
+	if args.bool("ignore_case") {
+		combined.WriteString("(?i)")
+	}
+	group := 1
+	for idx, p := range patterns {
+		source := p.Pattern
+		if !isRegexp {
+			source = regexp.QuoteMeta(source)
+		}
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return nil, fnErrorf("args", "builtin %s requires patterns[%d] to be a valid regexp: %v", f.Name, idx, err)
+		}
+		if idx > 0 {
+			combined.WriteString("|")
+		}
+		combined.WriteString("(" + source + ")")
+		m.groups = append(m.groups, group)
+		m.messages = append(m.messages, p.Message)
+		group += 1 + re.NumSubexp()
+	}
+	m.re = regexp.MustCompile(combined.String())
+	return m, nil
+}
+
+// matches returns the matches of every pattern ordered by position. Literal patterns may
+// overlap each other while a combined regexp reports the leftmost match at each position.
+func (m *anyMatcher) matches(text string) []Match {
+	if m.literals != nil {
+		var matches []Match
+		for patternIdx, hits := range m.literals.matches(text) {
+			for _, hit := range hits {
+				hit.Message = m.messages[patternIdx]
+				matches = append(matches, hit)
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if matches[i].Range.Start != matches[j].Range.Start {
+				return matches[i].Range.Start < matches[j].Range.Start
+			}
+			return matches[i].Range.End < matches[j].Range.End
+		})
+		return matches
+	}
+
+	var matches []Match
+	for _, loc := range m.re.FindAllStringSubmatchIndex(text, -1) {
+		match := Match{Range: &Range{Start: loc[0], End: loc[1]}}
+		for idx, group := range m.groups {
+			if loc[2*group] >= 0 {
+				match.Message = m.messages[idx]
+				break
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+func buildAnyMatchesFn(f RawFn, args builtinArgs) (RuleFunc, error) {
+	m, err := newAnyMatcher(f, args)
+	if err != nil {
+		return nil, err
+	}
+	return func(_path string, _idx int, text string) []Match {
+		return m.matches(text)
+	}, nil
+}
+
+// buildPathAnyFn reports paths matching any of the patterns with the message of the first match
+func buildPathAnyFn(f RawFn, args builtinArgs) (RuleFunc, error) {
+	m, err := newAnyMatcher(f, args)
+	if err != nil {
+		return nil, err
+	}
+	return func(path string, _idx int, _file string) []Match {
+		matches := m.matches(path)
+		if len(matches) == 0 {
+			return nil
+		}
+		return []Match{{Message: matches[0].Message}}
+	}, nil
+}
+
+// buildRegexpMultilineFn matches the pattern against the whole file, where ^ and $ match at
+// line boundaries unless multiline is false and . matches newlines when dot_all is set, and
+// reports the lines and columns each match starts and ends at
+func buildRegexpMultilineFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	flags := ""
+	if args.bool("ignore_case") {
+		flags += "i"
+	}
+	if args.bool("multiline") {
+		flags += "m"
+	}
+	if args.bool("dot_all") {
+		flags += "s"
+	}
+	re := args.regexp("pattern")
+	if flags != "" {
+		re = regexp.MustCompile("(?" + flags + ")" + re.String())
+	}
+	return func(_path string, _idx int, file string) []Match {
+		var matches []Match
+		var lineStarts []int
+		for _, loc := range re.FindAllStringIndex(file, -1) {
+			if lineStarts == nil {
+				lineStarts = lineStartOffsets(file)
+			}
+			line, column := lineColumnAt(file, lineStarts, loc[0])
+			endLine, endColumn := lineColumnAt(file, lineStarts, loc[1])
+			matches = append(matches, Match{
+				Range:     &Range{Start: loc[0], End: loc[1]},
+				Line:      line,
+				Column:    column,
+				EndLine:   endLine,
+				EndColumn: endColumn,
+			})
+		}
+		return matches
+	}, nil
+}
+
+// lineColumnAt converts a byte offset into a 1-indexed line and character column
+func lineColumnAt(content string, lineStarts []int, offset int) (int, int) {
+	line := sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > offset }) - 1
+	return line + 1, utf8.RuneCountInString(content[lineStarts[line]:offset]) + 1
+}
+
+// buildReplaceFn pairs a regexp with a replacement template, where $1 or ${name} expand
+// to capture groups, and offers each rewritten match as a fix
+func buildReplaceFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	matchOn := newPatternMatcher(args).re
+	replacement := args.string("replacement")
+	return func(_path string, _idx int, text string) []Match {
+		var matches []Match
+		for _, loc := range matchOn.FindAllStringSubmatchIndex(text, -1) {
+			expanded := matchOn.ExpandString(nil, replacement, text, loc)
+			matches = append(matches, Match{
+				Range: &Range{Start: loc[0], End: loc[1]},
+				Fix:   &Edit{Start: loc[0], End: loc[1], Replacement: string(expanded)},
+			})
+		}
+		return matches
+	}, nil
+}
+
+func buildMaxLineLengthFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	limit := args.int("max")
+	return func(_path string, _idx int, line string) []Match {
+		line = strings.TrimSuffix(line, "\r")
+		length := utf8.RuneCountInString(line)
+		if length <= limit {
+			return nil
+		}
+		// The range covers the characters past the limit
+		start := 0
+		for n := 0; n < limit; n++ {
+			_, size := utf8.DecodeRuneInString(line[start:])
+			start += size
+		}
+		return []Match{{
+			Range:   &Range{Start: start, End: len(line)},
+			Message: fmt.Sprintf("Line is %d characters long, the limit is %d", length, limit),
+		}}
+	}, nil
+}
+
+func buildTrailingWhitespaceFn(_ RawFn, _ builtinArgs) (RuleFunc, error) {
+	return func(_path string, _idx int, line string) []Match {
+		content := strings.TrimSuffix(line, "\r")
+		trimmed := strings.TrimRight(content, " \t")
+		if len(trimmed) == len(content) {
+			return nil
+		}
+		return []Match{{
+			Range: &Range{Start: len(trimmed), End: len(content)},
+			Fix:   &Edit{Start: len(trimmed), End: len(content)},
+		}}
+	}, nil
+}
+
+func buildNoTabsFn(_ RawFn, _ builtinArgs) (RuleFunc, error) {
+	return func(_path string, _idx int, line string) []Match {
+		return containsMatches(line, "\t")
+	}, nil
+}
+
+// lineCount counts lines the way editors do, without an empty line after a final newline
+func lineCount(file string) int {
+	if file == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(file, "\n"), "\n") + 1
+}
+
+func buildMaxFileLinesFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	limit := args.int("max")
+	return func(_path string, _idx int, file string) []Match {
+		count := lineCount(file)
+		if count <= limit {
+			return nil
+		}
+		return []Match{{
+			Line:    limit + 1,
+			Message: fmt.Sprintf("File has %d lines, the limit is %d", count, limit),
+		}}
+	}, nil
+}
+
+func buildMaxFileSizeFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	limit := args.int("max")
+	return func(_path string, _idx int, file string) []Match {
+		if len(file) <= limit {
+			return nil
+		}
+		return []Match{{Message: fmt.Sprintf("File is %d bytes, the limit is %d", len(file), limit)}}
+	}, nil
+}
+
+func buildMustEndWithNewlineFn(_ RawFn, _ builtinArgs) (RuleFunc, error) {
+	return func(_path string, _idx int, file string) []Match {
+		if file == "" || strings.HasSuffix(file, "\n") {
+			return nil
+		}
+		return []Match{{
+			Line: lineCount(file),
+			Fix:  &Edit{Start: len(file), End: len(file), Replacement: "\n"},
+		}}
+	}, nil
+}
+
+// buildRequiredHeaderFn requires the file to start with the header, after a shebang line
+// unless skip_shebang is false, and offers to insert it
+func buildRequiredHeaderFn(f RawFn, args builtinArgs) (RuleFunc, error) {
+	header := strings.TrimSuffix(args.string("header"), "\n")
+	if header == "" {
+		return nil, fnErrorf("args", "builtin %s requires a non empty header", f.Name)
+	}
+	skipShebang := args.bool("skip_shebang")
+	return func(_path string, _idx int, file string) []Match {
+		start, line := 0, 1
+		if skipShebang && strings.HasPrefix(file, "#!") {
+			if end := strings.IndexByte(file, '\n'); end >= 0 {
+				start, line = end+1, 2
+			}
+		}
+		if strings.HasPrefix(strings.ReplaceAll(file[start:], "\r\n", "\n"), header) {
+			return nil
+		}
+		return []Match{{
+			Line: line,
+			Fix:  &Edit{Start: start, End: start, Replacement: header + "\n"},
+		}}
+	}, nil
+}
+
+// filenameCases are the naming conventions filename_case accepts, matched against each dot
+// separated part of a file name without its extension
+var filenameCases = map[string]*regexp.Regexp{
+	"kebab":  regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`),
+	"snake":  regexp.MustCompile(`^[a-z0-9]+(?:_[a-z0-9]+)*$`),
+	"camel":  regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`),
+	"pascal": regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`),
+}
+
+func buildFilenameCaseFn(_ RawFn, args builtinArgs) (RuleFunc, error) {
+	name := args.string("case")
+	re := filenameCases[name]
+	return func(path string, _idx int, _file string) []Match {
+		base := filepath.Base(path)
+		stem := strings.TrimSuffix(base, filepath.Ext(base))
+		// Dotfiles such as .eslintrc have no name to check
+		if stem == "" {
+			return nil
+		}
+		for _, part := range strings.Split(stem, ".") {
+			if !re.MatchString(part) {
+				return []Match{{Message: fmt.Sprintf("File name %s isn't %s case", base, name)}}
+			}
+		}
+		return nil
+	}, nil
+}
+
+func buildForbiddenExtensionFn(f RawFn, args builtinArgs) (RuleFunc, error) {
+	extensions := args.strings("extensions")
+	for idx, ext := range extensions {
+		if strings.TrimPrefix(ext, ".") == "" {
+			return nil, fnErrorf("args", "builtin %s requires extensions[%d] to be an extension", f.Name, idx)
+		}
+		extensions[idx] = "." + strings.ToLower(strings.TrimPrefix(ext, "."))
+	}
+	return func(path string, _idx int, _file string) []Match {
+		lower := strings.ToLower(path)
+		for _, ext := range extensions {
+			if strings.HasSuffix(lower, ext) {
+				return []Match{{Message: fmt.Sprintf("Files with the %s extension aren't allowed", ext)}}
+			}
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,210 @@
+package polylint
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// resultCacheVersion is part of every cache key, bump it when the cached FileReport changes shape
+const resultCacheVersion = 6
+
+// ResultCache stores the report of each linted file on disk, keyed by the file's path and
+// content along with a hash of the resolved rule set, so unchanged files skip evaluating rules
+type ResultCache struct {
+	dir      string
+	rulesKey string
+	cfg      ConfigFile
+}
+
+// CacheDirResults is where ResultCache keeps reports, next to the wasm module cache
+func CacheDirResults() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(home, ".local", "cache", "polylint", "results"), nil
+}
+
+type ruleFingerprint struct {
+	Id             string
+	Description    string
+	Recommendation string
+	Severity       SeverityLevel
+	Link           string
+	IncludePaths   string
+	ExcludePaths   string
+	Scope          Scope
+	Fn             RawFn
+	// WASM is the sha256 of the wasm module, which Fn only names by path or url
+	WASM string
+}
+
+// rulesHash hashes everything that affects the findings of a rule set. It returns false when
+// the rules can't be hashed, such as a wasm module fetched from a url without a pinned hash.
+func rulesHash(cfg ConfigFile) (string, bool) {
+	fingerprints := make([]ruleFingerprint, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		fp := ruleFingerprint{
+			Id:             rule.Id,
+			Description:    rule.Description,
+			Recommendation: rule.Recommendation,
+			Severity:       rule.Severity,
+			Link:           rule.Link,
+			Scope:          rule.Scope,
+			Fn:             rule.source,
+		}
+		if rule.IncludePaths != nil {
+			fp.IncludePaths = rule.IncludePaths.String()
+		}
+		if rule.ExcludePaths != nil {
+			fp.ExcludePaths = rule.ExcludePaths.String()
+		}
+		if FnType(rule.source.Type) == wasmType {
+			hash, err := rule.source.GetMetadataHash()
+			if err != nil || hash == "" {
+				if strings.HasPrefix(rule.source.Body, "http") {
+					return "", false
+				}
+				content, err := rule.source.GetWASMFromPath(rule.source.Body)
+				if err != nil {
+					return "", false
+				}
+				hash = SHA256(string(content))
+			}
+			fp.WASM = hash
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+
+	type ruleOverrideFingerprint struct {
+		Off      bool
+		Severity SeverityLevel
+		Args     RawArgs
+	}
+	type overrideFingerprint struct {
+		Base  string
+		Files []string
+		Rules map[string]ruleOverrideFingerprint
+	}
+	overrides := make([]overrideFingerprint, 0, len(cfg.Overrides))
+	for _, override := range cfg.Overrides {
+		fp := overrideFingerprint{Base: override.base, Files: override.Files, Rules: make(map[string]ruleOverrideFingerprint)}
+		for id, ruleOverride := range override.Rules {
+			fp.Rules[id] = ruleOverrideFingerprint{Off: ruleOverride.Off, Severity: ruleOverride.Severity, Args: ruleOverride.source.Args}
+		}
+		overrides = append(overrides, fp)
+	}
+
+	content, err := json.Marshal(struct {
+		CacheVersion        int
+		BinaryVersion       string
+		RequireIgnoreReason bool
+		Rules               []ruleFingerprint
+		Overrides           []overrideFingerprint
+	}{resultCacheVersion, viper.GetString("binary_version"), cfg.RequireIgnoreReason, fingerprints, overrides})
+	if err != nil {
+		return "", false
+	}
+	return SHA256(string(content)), true
+}
+
+// NewResultCache returns a cache for the rule set in cfg, or nil when the rules can't be
+// cached. A nil cache is valid and never hits.
+func NewResultCache(cfg ConfigFile) (*ResultCache, error) {
+	rulesKey, ok := rulesHash(cfg)
+	if !ok {
+		logz.Infof("result cache disabled, a wasm rule isn't pinned by its sha256")
+		return nil, nil
+	}
+	dir, err := CacheDirResults()
+	if err != nil {
+		return nil, err
+	}
+	return &ResultCache{dir: dir, rulesKey: rulesKey, cfg: cfg}, nil
+}
+
+func (c *ResultCache) entryPath(filePath string, content []byte) string {
+	key := SHA256(c.rulesKey + "\x00" + filepath.ToSlash(filePath) + "\x00" + SHA256(string(content)))
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// Get returns the cached report for the file, with its rules reattached as the overrides
+// matching the file changed them
+func (c *ResultCache) Get(filePath string, content []byte) (FileReport, bool) {
+	if c == nil {
+		return FileReport{}, false
+	}
+	raw, err := os.ReadFile(c.entryPath(filePath, content))
+	if err != nil {
+		return FileReport{}, false
+	}
+	var report FileReport
+	if err := json.Unmarshal(raw, &report); err != nil {
+		logz.Warnf("ignoring unreadable result cache entry for %s: %v", filePath, err)
+		return FileReport{}, false
+	}
+
+	report.Rules = c.cfg.Rules
+	rulesById := make(map[string]Rule, len(c.cfg.Rules)+len(directiveRules))
+	for id, rule := range directiveRules {
+		rulesById[id] = rule
+	}
+	for _, rule := range c.cfg.rulesFor(filePath) {
+		rulesById[rule.Id] = rule
+	}
+	for _, findings := range [][]Finding{report.Findings, report.Suppressed} {
+		for idx := range findings {
+			rule, ok := rulesById[findings[idx].RuleId]
+			if !ok {
+				return FileReport{}, false
+			}
+			findings[idx].Rule = rule
+		}
+	}
+	return report, true
+}
+
+// Put stores the report for the file. Failing to write the cache isn't fatal to a run.
+func (c *ResultCache) Put(filePath string, content []byte, report FileReport) {
+	if c == nil {
+		return
+	}
+	entry := c.entryPath(filePath, content)
+	raw, err := json.Marshal(report)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(entry), 0755)
+	}
+	if err == nil {
+		// Write then rename so concurrent runs never read a partial entry
+		var tmp *os.File
+		if tmp, err = os.CreateTemp(filepath.Dir(entry), "*.tmp"); err == nil {
+			_, err = tmp.Write(raw)
+			if closeErr := tmp.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = os.Rename(tmp.Name(), entry)
+			}
+			if err != nil {
+				os.Remove(tmp.Name())
+			}
+		}
+	}
+	if err != nil {
+		logz.Warnf("error writing result cache entry for %s: %v", filePath, err)
+	}
+}
+
+// CleanResultCache removes every cached report
+func CleanResultCache() error {
+	dir, err := CacheDirResults()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,186 @@
+package polylint
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ConfigError describes a single problem found while loading a config file
+type ConfigError struct {
+	RuleId string
+	// Source is the config file or include path the problem was found in
+	Source string
+	// IncludedFrom is the config file that included Source, if any
+	IncludedFrom string
+	Line         int
+	Column       int
+	Err          error
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	source := e.Source
+	if source == "" {
+		source = "<config>"
+	}
+	b.WriteString(source)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, ":%d", e.Column)
+		}
+	}
+	b.WriteString(": ")
+	if e.RuleId != "" {
+		fmt.Fprintf(&b, "rule %s: ", e.RuleId)
+	}
+	b.WriteString(e.Err.Error())
+	if e.IncludedFrom != "" {
+		fmt.Fprintf(&b, " (included from %s)", e.IncludedFrom)
+	}
+	return b.String()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors collects every ConfigError found in one pass over a config
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for idx, err := range e {
+		msgs[idx] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// fnError attributes a function build failure to a field of the fn definition
+type fnError struct {
+	field string
+	err   error
+}
+
+func (e *fnError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fnError) Unwrap() error {
+	return e.err
+}
+
+func fnErrorf(field string, format string, args ...any) error {
+	return &fnError{field: field, err: fmt.Errorf(format, args...)}
+}
+
+// fnErrorField returns the fn field responsible for err, if known
+func fnErrorField(err error) string {
+	var fe *fnError
+	if errors.As(err, &fe) {
+		return fe.field
+	}
+	return ""
+}
+
+// configPositions looks up the line and column of config nodes. The config is decoded with
+// yaml.v2, which doesn't expose positions, so the document is parsed a second time as a node tree.
+type configPositions struct {
+	root *yamlv3.Node
+}
+
+func newConfigPositions(content string) configPositions {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal([]byte(content), &doc); err != nil || len(doc.Content) == 0 {
+		return configPositions{}
+	}
+	return configPositions{root: doc.Content[0]}
+}
+
+func mappingValue(node *yamlv3.Node, key string) (*yamlv3.Node, *yamlv3.Node) {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// lookup walks from the top level key through a sequence index and nested keys, returning
+// the position of the deepest node found
+func (p configPositions) lookup(section string, idx int, keys ...string) (int, int) {
+	_, seq := mappingValue(p.root, section)
+	if seq == nil || seq.Kind != yamlv3.SequenceNode || idx >= len(seq.Content) {
+		if p.root != nil {
+			return p.root.Line, p.root.Column
+		}
+		return 0, 0
+	}
+	node := seq.Content[idx]
+	line, col := node.Line, node.Column
+	for _, key := range keys {
+		if key == "" {
+			break
+		}
+		k, v := mappingValue(node, key)
+		if k == nil {
+			break
+		}
+		line, col = k.Line, k.Column
+		node = v
+	}
+	return line, col
+}
+
+func (p configPositions) rule(idx int, keys ...string) (int, int) {
+	return p.lookup("rules", idx, keys...)
+}
+
+func (p configPositions) include(idx int, keys ...string) (int, int) {
+	return p.lookup("includes", idx, keys...)
+}
+
+func (p configPositions) override(idx int, keys ...string) (int, int) {
+	return p.lookup("overrides", idx, keys...)
+}
+
+func (p configPositions) key(key string) (int, int) {
+	k, _ := mappingValue(p.root, key)
+	if k == nil {
+		return 0, 0
+	}
+	return k.Line, k.Column
+}
+
+var yamlErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// yamlConfigErrors converts yaml.v2 errors, which embed the line number in their message
+func yamlConfigErrors(err error, source string) ConfigErrors {
+	var msgs []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	} else {
+		msgs = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	var errs ConfigErrors
+	for _, msg := range msgs {
+		configErr := &ConfigError{Source: source, Err: errors.New(msg)}
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			configErr.Line, _ = strconv.Atoi(m[1])
+			configErr.Err = errors.New(m[2])
+		}
+		errs = append(errs, configErr)
+	}
+	return errs
+}
@@ -0,0 +1,414 @@
+package polylint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+type dataKind int
+
+const (
+	scalarData dataKind = iota
+	mappingData
+	sequenceData
+)
+
+// dataNode is a value parsed from a json, yaml or toml file along with where it starts
+type dataNode struct {
+	kind dataKind
+	// value of a scalar, normalized by normalizeValue
+	value any
+	// keys of a mapping in the order they appear in the file
+	keys   []string
+	fields map[string]*dataNode
+	items  []*dataNode
+	// line and column are 1-indexed, 0 when unknown
+	line   int
+	column int
+}
+
+func (n *dataNode) set(key string, child *dataNode) {
+	if n.fields == nil {
+		n.fields = make(map[string]*dataNode)
+	}
+	if _, ok := n.fields[key]; !ok {
+		n.keys = append(n.keys, key)
+	}
+	n.fields[key] = child
+}
+
+// plain returns the node as plain maps, slices and normalized scalars for comparison
+func (n *dataNode) plain() any {
+	switch n.kind {
+	case mappingData:
+		m := make(map[string]any, len(n.fields))
+		for key, child := range n.fields {
+			m[key] = child.plain()
+		}
+		return m
+	case sequenceData:
+		items := make([]any, len(n.items))
+		for idx, item := range n.items {
+			items[idx] = item.plain()
+		}
+		return items
+	default:
+		return n.value
+	}
+}
+
+// normalizeValue converts a value decoded from a file or from a rule's args so that equal
+// values compare equal whichever decoder produced them. Numbers become float64, mappings
+// become map[string]any and other scalars become strings.
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case nil, bool, string, float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeValue(item)
+		}
+		return m
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[key] = normalizeValue(item)
+		}
+		return m
+	case []any:
+		items := make([]any, len(v))
+		for idx, item := range v {
+			items[idx] = normalizeValue(item)
+		}
+		return items
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// formatValue renders a normalized value for messages, quoting strings as json does
+func formatValue(value any) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// newDataNode converts a decoded value into nodes, with the position of each node looked up
+// by its path
+func newDataNode(value any, path string, positions map[string][2]int) *dataNode {
+	position := positions[path]
+	n := &dataNode{line: position[0], column: position[1]}
+	switch v := value.(type) {
+	case map[string]any:
+		n.kind = mappingData
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := positions[keyPath(path, keys[i])], positions[keyPath(path, keys[j])]
+			if a != b {
+				return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+			}
+			return keys[i] < keys[j]
+		})
+		for _, key := range keys {
+			n.set(key, newDataNode(v[key], keyPath(path, key), positions))
+		}
+	case []any:
+		n.kind = sequenceData
+		for idx, item := range v {
+			n.items = append(n.items, newDataNode(item, indexPath(path, idx), positions))
+		}
+	default:
+		n.value = normalizeValue(v)
+	}
+	return n
+}
+
+// dataParsers parse a file into its documents for each of the structured data builtins
+var dataParsers = map[string]func(string) ([]*dataNode, error){
+	"json_path": parseJSONNodes,
+	"yaml_path": parseYAMLNodes,
+	"toml_path": parseTOMLNodes,
+}
+
+func parseJSONNodes(content string) ([]*dataNode, error) {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	lineStarts := lineStartOffsets(content)
+	root, err := decodeJSONNode(dec, content, lineStarts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected content after the top level value")
+	}
+	return []*dataNode{root}, nil
+}
+
+func decodeJSONNode(dec *json.Decoder, content string, lineStarts []int) (*dataNode, error) {
+	// The decoder's offset is after the previous token, before any separator and whitespace
+	offset := int(dec.InputOffset())
+	for offset < len(content) && strings.IndexByte(" \t\r\n,:", content[offset]) >= 0 {
+		offset++
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	n := &dataNode{}
+	n.line, n.column = lineColumnAt(content, lineStarts, offset)
+	switch tok {
+	case json.Delim('{'):
+		n.kind = mappingData
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			child, err := decodeJSONNode(dec, content, lineStarts)
+			if err != nil {
+				return nil, err
+			}
+			n.set(key.(string), child)
+		}
+		_, err = dec.Token()
+	case json.Delim('['):
+		n.kind = sequenceData
+		for dec.More() {
+			child, err := decodeJSONNode(dec, content, lineStarts)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, child)
+		}
+		_, err = dec.Token()
+	default:
+		n.value = normalizeValue(tok)
+	}
+	return n, err
+}
+
+func parseYAMLNodes(content string) ([]*dataNode, error) {
+	dec := yamlv3.NewDecoder(strings.NewReader(content))
+	var docs []*dataNode
+	for {
+		var doc yamlv3.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			docs = append(docs, &dataNode{line: doc.Line, column: doc.Column})
+			continue
+		}
+		node, err := (&yamlConverter{}).convert(doc.Content[0])
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, node)
+	}
+}
+
+// maxYAMLNodes stops aliases from expanding a small file into an enormous tree
+const maxYAMLNodes = 1 << 20
+
+// yamlConverter converts yaml nodes, expanding aliases, while counting the nodes it creates
+type yamlConverter struct {
+	nodes int
+}
+
+func (c *yamlConverter) convert(y *yamlv3.Node) (*dataNode, error) {
+	c.nodes++
+	if c.nodes > maxYAMLNodes {
+		return nil, errors.New("too many nodes after expanding aliases")
+	}
+	n := &dataNode{line: y.Line, column: y.Column}
+	switch y.Kind {
+	case yamlv3.AliasNode:
+		target, err := c.convert(y.Alias)
+		if err != nil {
+			return nil, err
+		}
+		target.line, target.column = y.Line, y.Column
+		return target, nil
+	case yamlv3.MappingNode:
+		n.kind = mappingData
+		var merges []*yamlv3.Node
+		for idx := 0; idx+1 < len(y.Content); idx += 2 {
+			key, value := y.Content[idx], y.Content[idx+1]
+			if key.ShortTag() == "!!merge" {
+				merges = append(merges, value)
+				continue
+			}
+			child, err := c.convert(value)
+			if err != nil {
+				return nil, err
+			}
+			n.set(key.Value, child)
+		}
+		// Merged keys fill in the keys the mapping doesn't set itself, with earlier mappings
+		// of a merged sequence winning over later ones
+		for _, merge := range merges {
+			sources := []*yamlv3.Node{merge}
+			if merge.Kind == yamlv3.SequenceNode {
+				sources = merge.Content
+			}
+			for _, source := range sources {
+				merged, err := c.convert(source)
+				if err != nil {
+					return nil, err
+				}
+				if merged.kind != mappingData {
+					return nil, fmt.Errorf("line %d: merge key requires a mapping or a list of mappings", source.Line)
+				}
+				for _, key := range merged.keys {
+					if _, ok := n.fields[key]; !ok {
+						n.set(key, merged.fields[key])
+					}
+				}
+			}
+		}
+	case yamlv3.SequenceNode:
+		n.kind = sequenceData
+		for _, item := range y.Content {
+			child, err := c.convert(item)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, child)
+		}
+	default:
+		var value any
+		if err := y.Decode(&value); err != nil {
+			return nil, err
+		}
+		n.value = normalizeValue(value)
+	}
+	return n, nil
+}
+
+// parseTOMLNodes decodes the values with the toml package and finds the position of each
+// key, array table and array item with its parser
+func parseTOMLNodes(content string) ([]*dataNode, error) {
+	var values map[string]any
+	if err := toml.Unmarshal([]byte(content), &values); err != nil {
+		return nil, err
+	}
+
+	lineStarts := lineStartOffsets(content)
+	positions := map[string][2]int{"$": {1, 1}}
+	setPosition := func(path string, offset uint32) {
+		if _, ok := positions[path]; !ok {
+			line, column := lineColumnAt(content, lineStarts, int(offset))
+			positions[path] = [2]int{line, column}
+		}
+	}
+	// arrayTables counts the tables of each array of tables, whose last table is the one
+	// later headers and keys below it refer to
+	arrayTables := make(map[string]int)
+	keyPaths := func(base string, key unstable.Iterator, isArrayTable bool) (string, uint32) {
+		path := base
+		var offset uint32
+		for key.Next() {
+			part := key.Node()
+			offset = part.Raw.Offset
+			path = keyPath(path, string(part.Data))
+			setPosition(path, offset)
+			if count, ok := arrayTables[path]; ok && !(isArrayTable && key.IsLast()) {
+				path = indexPath(path, count-1)
+			}
+		}
+		if isArrayTable {
+			arrayTables[path]++
+			path = indexPath(path, arrayTables[path]-1)
+			setPosition(path, offset)
+		}
+		return path, offset
+	}
+	var setValuePositions func(path string, value *unstable.Node, offset uint32)
+	setValuePositions = func(path string, value *unstable.Node, offset uint32) {
+		switch value.Kind {
+		case unstable.InlineTable:
+			children := value.Children()
+			for children.Next() {
+				kv := children.Node()
+				childPath, childOffset := keyPaths(path, kv.Key(), false)
+				setValuePositions(childPath, kv.Value(), childOffset)
+			}
+		case unstable.Array:
+			items := value.Children()
+			for idx := 0; items.Next(); idx++ {
+				item := items.Node()
+				itemOffset := offset
+				if item.Raw.Length > 0 {
+					itemOffset = item.Raw.Offset
+				}
+				setPosition(indexPath(path, idx), itemOffset)
+				setValuePositions(indexPath(path, idx), item, itemOffset)
+			}
+		}
+	}
+
+	p := unstable.Parser{}
+	p.Reset([]byte(content))
+	table := "$"
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table:
+			table, _ = keyPaths("$", expr.Key(), false)
+		case unstable.ArrayTable:
+			table, _ = keyPaths("$", expr.Key(), true)
+		case unstable.KeyValue:
+			path, offset := keyPaths(table, expr.Key(), false)
+			setValuePositions(path, expr.Value(), offset)
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	return []*dataNode{newDataNode(values, "$", positions)}, nil
+}
+
+// equalValues compares a node with a normalized value
+func equalValues(n *dataNode, value any) bool {
+	return reflect.DeepEqual(n.plain(), value)
+}
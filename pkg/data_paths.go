@@ -0,0 +1,272 @@
+package polylint
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type pathStepKind int
+
+const (
+	keyStep pathStepKind = iota
+	indexStep
+	wildcardStep
+)
+
+// pathStep is one step of a data path, such as .name, [0] or [*]. Recursive steps, written
+// with .. before them, apply to the node and every node below it.
+type pathStep struct {
+	kind      pathStepKind
+	key       string
+	index     int
+	recursive bool
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// keyPath and indexPath extend a path as it is shown in messages, like $.spec.containers[0]
+func keyPath(path, key string) string {
+	if identifierPattern.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+func indexPath(path string, idx int) string {
+	return fmt.Sprintf("%s[%d]", path, idx)
+}
+
+// parseDataPath parses a subset of JSONPath: an optional $ followed by .name, ["name"],
+// ['name'], [0], .* or [*] steps, any of them after .. to search at every depth. A path
+// may also start with a bare name, so spec.replicas is $.spec.replicas.
+func parseDataPath(expr string) ([]pathStep, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+	var steps []pathStep
+	for rest != "" {
+		step := pathStep{}
+		if strings.HasPrefix(rest, "..") {
+			step.recursive = true
+			rest = rest[2:]
+			if rest != "" && rest[0] != '[' {
+				rest = "." + rest
+			}
+		}
+		switch {
+		case strings.HasPrefix(rest, ".*"):
+			step.kind = wildcardStep
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			step.key = rest[1 : end+1]
+			if step.key == "" {
+				return nil, fmt.Errorf("missing name at %q", rest)
+			}
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if len(rest) > 2 && (rest[1] == '"' || rest[1] == '\'') {
+				end = strings.Index(rest[2:], rest[1:2]+"]")
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated quote at %q", rest)
+				}
+				step.key = rest[2 : end+2]
+				rest = rest[end+4:]
+				break
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("missing ] at %q", rest)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if inner == "*" {
+				step.kind = wildcardStep
+				break
+			}
+			idx, err := strconv.Atoi(inner)
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("%q isn't an index, quote names like [\"name\"]", inner)
+			}
+			step.kind, step.index = indexStep, idx
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// pathMatch is a node selected by a data path along with its concrete path
+type pathMatch struct {
+	node *dataNode
+	path string
+}
+
+// children returns the nodes the step selects directly below n
+func (s pathStep) children(m pathMatch) []pathMatch {
+	switch {
+	case s.kind == keyStep && m.node.kind == mappingData:
+		if child, ok := m.node.fields[s.key]; ok {
+			return []pathMatch{{child, keyPath(m.path, s.key)}}
+		}
+	case s.kind == indexStep && m.node.kind == sequenceData:
+		if s.index < len(m.node.items) {
+			return []pathMatch{{m.node.items[s.index], indexPath(m.path, s.index)}}
+		}
+	case s.kind == wildcardStep && m.node.kind == mappingData:
+		var children []pathMatch
+		for _, key := range m.node.keys {
+			children = append(children, pathMatch{m.node.fields[key], keyPath(m.path, key)})
+		}
+		return children
+	case s.kind == wildcardStep && m.node.kind == sequenceData:
+		var children []pathMatch
+		for idx, item := range m.node.items {
+			children = append(children, pathMatch{item, indexPath(m.path, idx)})
+		}
+		return children
+	}
+	return nil
+}
+
+// descendants returns m followed by every node below it in document order
+func descendants(m pathMatch) []pathMatch {
+	all := []pathMatch{m}
+	for _, child := range (pathStep{kind: wildcardStep}).children(m) {
+		all = append(all, descendants(child)...)
+	}
+	return all
+}
+
+// selectPath returns the nodes the steps select below root, and the nodes where a name or
+// index step found nothing with the path that is missing. Wildcards and recursive steps
+// select any number of nodes, including none, so they are never missing.
+func selectPath(root *dataNode, steps []pathStep) (found, missing []pathMatch) {
+	found = []pathMatch{{root, "$"}}
+	for _, step := range steps {
+		var next []pathMatch
+		seen := make(map[*dataNode]bool)
+		for _, m := range found {
+			candidates := []pathMatch{m}
+			if step.recursive {
+				candidates = descendants(m)
+			}
+			for _, candidate := range candidates {
+				children := step.children(candidate)
+				if len(children) == 0 && !step.recursive && step.kind != wildcardStep {
+					missingPath := indexPath(m.path, step.index)
+					if step.kind == keyStep {
+						missingPath = keyPath(m.path, step.key)
+					}
+					missing = append(missing, pathMatch{m.node, missingPath})
+				}
+				for _, child := range children {
+					if !seen[child.node] {
+						seen[child.node] = true
+						next = append(next, child)
+					}
+				}
+			}
+		}
+		found = next
+	}
+	return found, missing
+}
+
+// dataPathArgs are the args of json_path, yaml_path and toml_path
+var dataPathArgs = []argSpec{
+	{Name: "path", Type: stringArgType, Required: true},
+	{Name: "assert", Type: stringArgType, Default: "exists", OneOf: []string{"absent", "equals", "exists", "matches"}},
+	{Name: "value", Type: anyArgType},
+}
+
+// buildDataPathFn parses files as json, yaml or toml and asserts that the nodes at a path
+// exist, are absent, equal a value or match a regexp, reporting the line of each offending
+// node. A missing node is reported at the closest node above it.
+func buildDataPathFn(f RawFn, args builtinArgs) (RuleFunc, error) {
+	steps, err := parseDataPath(args.string("path"))
+	if err != nil {
+		return nil, fnErrorf("args", "builtin %s requires path to be a valid path: %v", f.Name, err)
+	}
+	assert := args.string("assert")
+	value, hasValue := args["value"]
+	if hasValue != (assert == "equals" || assert == "matches") {
+		if hasValue {
+			return nil, fnErrorf("args", "builtin %s doesn't take a value to assert %s", f.Name, assert)
+		}
+		return nil, fnErrorf("args", "builtin %s requires a value to assert %s", f.Name, assert)
+	}
+	expected := normalizeValue(value)
+	var re *regexp.Regexp
+	if assert == "matches" {
+		pattern, ok := value.(string)
+		if !ok {
+			return nil, fnErrorf("args", "builtin %s requires value to be a regexp but was %T", f.Name, value)
+		}
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, fnErrorf("args", "builtin %s requires value to be a valid regexp: %v", f.Name, err)
+		}
+	}
+	parse := dataParsers[f.Name]
+	format := strings.ToUpper(strings.TrimSuffix(f.Name, "_path"))
+
+	return func(_path string, _idx int, file string) []Match {
+		docs, err := parse(file)
+		if err != nil {
+			return []Match{{Message: fmt.Sprintf("File isn't valid %s: %v", format, err)}}
+		}
+		// An empty file has a single empty document, so exists still reports it
+		if len(docs) == 0 {
+			docs = []*dataNode{{}}
+		}
+		var matches []Match
+		report := func(m pathMatch, message string) {
+			matches = append(matches, Match{Line: m.node.line, Column: m.node.column, Message: message})
+		}
+		for _, doc := range docs {
+			found, missing := selectPath(doc, steps)
+			switch assert {
+			case "exists":
+				for _, m := range missing {
+					report(m, fmt.Sprintf("%s is missing", m.path))
+				}
+			case "absent":
+				for _, m := range found {
+					report(m, fmt.Sprintf("%s is present", m.path))
+				}
+			case "equals":
+				for _, m := range found {
+					if !equalValues(m.node, expected) {
+						report(m, fmt.Sprintf("%s is %s, expected %s", m.path, formatValue(m.node.plain()), formatValue(expected)))
+					}
+				}
+			case "matches":
+				for _, m := range found {
+					if !matchesValue(m.node, re) {
+						report(m, fmt.Sprintf("%s is %s, which doesn't match %s", m.path, formatValue(m.node.plain()), re))
+					}
+				}
+			}
+		}
+		return matches
+	}, nil
+}
+
+// matchesValue matches a regexp against a scalar, with numbers and booleans as they are
+// written in json. Mappings and sequences never match.
+func matchesValue(n *dataNode, re *regexp.Regexp) bool {
+	if n.kind != scalarData || n.value == nil {
+		return false
+	}
+	if s, ok := n.value.(string); ok {
+		return re.MatchString(s)
+	}
+	return re.MatchString(formatValue(n.value))
+}
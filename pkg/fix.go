@@ -0,0 +1,251 @@
+package polylint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FixResult describes the outcome of applying the fixes of a FileReport
+type FixResult struct {
+	Path    string
+	Before  string
+	After   string
+	Applied []Finding
+	// Conflicts are findings whose fix overlaps a fix that was already applied
+	Conflicts []Finding
+}
+
+// Changed reports whether any fix modified the content
+func (r FixResult) Changed() bool {
+	return r.Before != r.After
+}
+
+// ApplyFixes applies every non-overlapping fix in the findings to content. Fixes are applied
+// in order of their start offset and the first fix over a range wins, any later fix that
+// overlaps it is returned as a conflict so that a second run can pick it up.
+func ApplyFixes(path string, content string, findings []Finding) FixResult {
+	result := FixResult{Path: path, Before: content, After: content}
+
+	var fixable []Finding
+	for _, finding := range findings {
+		if finding.Fix != nil {
+			fixable = append(fixable, finding)
+		}
+	}
+	sort.SliceStable(fixable, func(i, j int) bool {
+		return fixable[i].Fix.Start < fixable[j].Fix.Start
+	})
+
+	var b strings.Builder
+	cursor := 0
+	var last *Edit
+	for _, finding := range fixable {
+		fix := finding.Fix
+		if fix.End > len(content) {
+			result.Conflicts = append(result.Conflicts, finding)
+			continue
+		}
+		if last != nil {
+			// Identical edits from different rules are applied once
+			if *fix == *last {
+				result.Applied = append(result.Applied, finding)
+				continue
+			}
+			if fix.Start < last.End || fix.Start == last.Start {
+				result.Conflicts = append(result.Conflicts, finding)
+				continue
+			}
+		}
+		b.WriteString(content[cursor:fix.Start])
+		b.WriteString(fix.Replacement)
+		cursor = fix.End
+		last = fix
+		result.Applied = append(result.Applied, finding)
+	}
+	b.WriteString(content[cursor:])
+	result.After = b.String()
+	return result
+}
+
+type diffKind int
+
+const (
+	diffEqual diffKind = iota
+	diffDelete
+	diffInsert
+)
+
+type diffOp struct {
+	kind diffKind
+	// aIdx and bIdx are the line indexes in the old and new content
+	aIdx int
+	bIdx int
+	line string
+}
+
+// diffLines computes a shortest edit script between a and b with Myers' algorithm
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+2)
+	// trace keeps the diagonals -d..d of v before each step d, the only ones the backtrack
+	// reads, so it grows with the square of the edit distance rather than the file size
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		// The diagonal k of step d is at k+d in its window
+		vd := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && vd[k-1+d] < vd[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := vd[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{kind: diffEqual, aIdx: x, bIdx: y, line: a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{kind: diffInsert, aIdx: x, bIdx: y, line: b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{kind: diffDelete, aIdx: x, bIdx: y, line: a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{kind: diffEqual, aIdx: x, bIdx: y, line: a[x]})
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+const diffContext = 3
+
+// UnifiedDiff renders the change from before to after as a unified diff with three lines
+// of context, or an empty string when nothing changed
+func UnifiedDiff(path, before, after string) string {
+	if before == after {
+		return ""
+	}
+	ops := diffLines(splitLinesKeepEnds(before), splitLinesKeepEnds(after))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", path, path)
+
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].kind == diffEqual {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		hunkStart := start - diffContext
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		// Extend the hunk while changes are within two context windows of each other
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != diffEqual {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == diffEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		hunkEnd := end + diffContext
+		if hunkEnd > len(ops) {
+			hunkEnd = len(ops)
+		}
+
+		aStart, bStart := ops[hunkStart].aIdx, ops[hunkStart].bIdx
+		aLen, bLen := 0, 0
+		var body strings.Builder
+		for _, op := range ops[hunkStart:hunkEnd] {
+			switch op.kind {
+			case diffEqual:
+				aLen++
+				bLen++
+				body.WriteString(" ")
+			case diffDelete:
+				aLen++
+				body.WriteString("-")
+			case diffInsert:
+				bLen++
+				body.WriteString("+")
+			}
+			body.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		b.WriteString(body.String())
+		start = hunkEnd
+	}
+	return b.String()
+}
+
+// splitLinesKeepEnds splits content into lines that keep their trailing newline, so that a
+// missing newline at the end of the file shows up as a difference
+func splitLinesKeepEnds(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
@@ -0,0 +1,183 @@
+package polylint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ChangedLines maps a path to the line numbers added or modified in it. A nil set means
+// every line changed, which is the case for untracked files.
+type ChangedLines map[string]map[int]bool
+
+// Contains reports whether lineNo of path was added or modified
+func (c ChangedLines) Contains(path string, lineNo int) bool {
+	lines, ok := c[filepath.ToSlash(filepath.Clean(path))]
+	if !ok {
+		return false
+	}
+	return lines == nil || lines[lineNo]
+}
+
+func git(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// gitDiffArgs compares the working tree against ref, or the index against HEAD when staged.
+// Paths are relative to the current directory and deleted files are left out.
+func gitDiffArgs(ref string, staged bool, extra ...string) []string {
+	args := []string{"diff", "--relative", "--no-color", "--no-ext-diff", "--diff-filter=ACMR"}
+	args = append(args, extra...)
+	if staged {
+		return append(args, "--cached")
+	}
+	return append(args, ref, "--")
+}
+
+// splitPaths splits the NUL separated output of git commands run with -z, where paths are
+// never quoted
+func splitPaths(out []byte) []string {
+	var paths []string
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// GitChangedFiles lists the files changed since ref, including untracked files, or the staged
+// files when staged is set
+func GitChangedFiles(ref string, staged bool) ([]string, error) {
+	out, err := git(gitDiffArgs(ref, staged, "--name-only", "-z")...)
+	if err != nil {
+		return nil, err
+	}
+	files := splitPaths(out)
+	if staged {
+		return files, nil
+	}
+
+	untracked, err := git("ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	return append(files, splitPaths(untracked)...), nil
+}
+
+// GitStagedContent reads the content of path as it is staged in the index, which differs from
+// the working tree copy when the file is partially staged. The path is relative to the
+// current directory like the paths of GitChangedFiles.
+func GitStagedContent(path string) ([]byte, error) {
+	return git("cat-file", "blob", ":./"+filepath.ToSlash(path))
+}
+
+// diffPath returns the path of a "+++ b/path" line. Git ends the line with a tab when the path
+// contains a space, and quotes paths with characters such as quotes or newlines even when
+// core.quotePath is off.
+func diffPath(line string) (string, error) {
+	path := strings.TrimSuffix(strings.TrimPrefix(line, "+++ "), "\t")
+	if strings.HasPrefix(path, `"`) {
+		unquoted, err := strconv.Unquote(path)
+		if err != nil {
+			return "", fmt.Errorf("error reading the path of %q: %v", line, err)
+		}
+		path = unquoted
+	}
+	return strings.TrimPrefix(path, "b/"), nil
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// GitChangedLines parses the diff hunks since ref, or of the staged changes, into the lines
+// that were added or modified in each file
+func GitChangedLines(ref string, staged bool) (ChangedLines, error) {
+	// Without core.quotePath, non-ASCII paths are written as they are instead of octal escapes
+	args := append([]string{"-c", "core.quotePath=false"}, gitDiffArgs(ref, staged, "--unified=0", "--src-prefix=a/", "--dst-prefix=b/")...)
+	out, err := git(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(ChangedLines)
+	var current map[int]bool
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "+++ ") {
+			path, err := diffPath(line)
+			if err != nil {
+				return nil, err
+			}
+			current = make(map[int]bool)
+			changed[filepath.ToSlash(filepath.Clean(path))] = current
+			continue
+		}
+		m := hunkHeader.FindStringSubmatch(line)
+		if m == nil || current == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		for lineNo := start; lineNo < start+count; lineNo++ {
+			current[lineNo] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !staged {
+		untracked, err := git("ls-files", "-z", "--others", "--exclude-standard")
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range splitPaths(untracked) {
+			changed[filepath.ToSlash(filepath.Clean(path))] = nil
+		}
+	}
+	return changed, nil
+}
+
+// FilterChangedLines keeps line scoped findings only on changed lines. File and path scoped
+// findings apply to the whole file and are always kept.
+func FilterChangedLines(reports []FileReport, changed ChangedLines) []FileReport {
+	filtered := make([]FileReport, len(reports))
+	for idx, report := range reports {
+		findings := report.Findings
+		report.Findings = nil
+		for _, finding := range findings {
+			if finding.Rule.Scope != lineScope || changed.Contains(finding.Path, finding.LineNo) {
+				report.Findings = append(report.Findings, finding)
+			}
+		}
+		filtered[idx] = report
+	}
+	return filtered
+}
+
+// GitHooksDir returns the hooks directory of the current repository, respecting core.hooksPath
+// and worktrees
+func GitHooksDir() (string, error) {
+	out, err := git("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
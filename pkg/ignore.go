@@ -0,0 +1,361 @@
+package polylint
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// PolylintIgnoreFile holds gitignore style patterns that only apply to polylint
+const PolylintIgnoreFile = ".polylintignore"
+
+var ignoreFileNames = []string{".gitignore", PolylintIgnoreFile}
+
+type ignorePattern struct {
+	// base is the absolute directory the pattern is relative to
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreMatcher decides whether a path is excluded by gitignore style patterns.
+// Patterns added later take precedence, matching how git orders nested .gitignore files.
+type IgnoreMatcher struct {
+	patterns []ignorePattern
+}
+
+// globToRegexp converts a gitignore style glob into an anchored regexp matched against
+// slash separated relative paths. `**` spans directories while `*` and `?` do not.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func parseIgnorePattern(line, base string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+	p := ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// Patterns without an inner slash match at any depth below base
+	if strings.Contains(line, "/") {
+		line = strings.TrimPrefix(line, "/")
+	} else {
+		line = "**/" + line
+	}
+	re, err := globToRegexp(line)
+	if err != nil {
+		logz.Warnf("WARNING: skipping invalid ignore pattern %q in %s: %v\n", line, base, err)
+		return ignorePattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+// AddPatternsFromFile loads patterns from an ignore file, scoped to the base directory.
+// A missing file is not an error.
+func (m *IgnoreMatcher) AddPatternsFromFile(path, base string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := parseIgnorePattern(scanner.Text(), absBase); ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return scanner.Err()
+}
+
+func (m *IgnoreMatcher) addPatternsFromDir(dir string) error {
+	for _, name := range ignoreFileNames {
+		if err := m.AddPatternsFromFile(filepath.Join(dir, name), dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match reports whether the absolute path is ignored
+func (m *IgnoreMatcher) Match(absPath string, isDir bool) bool {
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(p.base, absPath)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if p.re.MatchString(filepath.ToSlash(rel)) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// findRepoRoot returns the closest ancestor of dir that contains a .git entry
+func findRepoRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+var (
+	globalExcludesOnce sync.Once
+	globalExcludesPath string
+)
+
+// globalExcludesFile resolves git's core.excludesFile once per process, since walking
+// hundreds of explicitly passed files would otherwise shell out to git for each of them
+func globalExcludesFile() string {
+	globalExcludesOnce.Do(func() {
+		globalExcludesPath = resolveGlobalExcludesFile()
+	})
+	return globalExcludesPath
+}
+
+// resolveGlobalExcludesFile resolves git's core.excludesFile, falling back to git's default location
+func resolveGlobalExcludesFile() string {
+	if _, err := exec.LookPath("git"); err == nil {
+		out, err := exec.Command("git", "config", "--get", "core.excludesFile").Output()
+		if err == nil && strings.TrimSpace(string(out)) != "" {
+			path := strings.TrimSpace(string(out))
+			if strings.HasPrefix(path, "~/") {
+				if home, err := os.UserHomeDir(); err == nil {
+					path = filepath.Join(home, path[2:])
+				}
+			}
+			return path
+		}
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// NewIgnoreMatcher builds a matcher for walking absRoot, loading the global excludes file,
+// the repository's .git/info/exclude and every ignore file between the repository root and absRoot
+func NewIgnoreMatcher(absRoot string) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{}
+	repoRoot, inRepo := findRepoRoot(absRoot)
+	base := absRoot
+	if inRepo {
+		base = repoRoot
+	}
+
+	if global := globalExcludesFile(); global != "" {
+		if err := m.AddPatternsFromFile(global, base); err != nil {
+			return nil, err
+		}
+	}
+	if !inRepo {
+		return m, nil
+	}
+	if err := m.AddPatternsFromFile(filepath.Join(repoRoot, ".git", "info", "exclude"), repoRoot); err != nil {
+		return nil, err
+	}
+
+	// Ancestors of the walk root, the walk itself picks up absRoot and below
+	var ancestors []string
+	for dir := filepath.Dir(absRoot); strings.HasPrefix(dir, repoRoot) && dir != absRoot; dir = filepath.Dir(dir) {
+		ancestors = append([]string{dir}, ancestors...)
+		if dir == repoRoot {
+			break
+		}
+	}
+	for _, dir := range ancestors {
+		if err := m.addPatternsFromDir(dir); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// WalkFiles calls fn for every file below root. Unless noIgnore is set, paths matched by
+// .gitignore files, core.excludesFile, .git/info/exclude or .polylintignore files are skipped
+// and ignored directories are pruned without being read. An explicitly passed file root is
+// always visited.
+func WalkFiles(root string, noIgnore bool, fn func(path string) error) error {
+	return walk(root, noIgnore, fn, nil)
+}
+
+// WalkDirs calls fn for root and every directory below it that WalkFiles would descend into
+func WalkDirs(root string, noIgnore bool, fn func(path string) error) error {
+	return walk(root, noIgnore, nil, fn)
+}
+
+func walk(root string, noIgnore bool, fileFn func(path string) error, dirFn func(path string) error) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	// Explicit files are always visited, skip loading ignore files for them
+	if info, err := os.Stat(root); err != nil {
+		return err
+	} else if !info.IsDir() {
+		if fileFn == nil {
+			return nil
+		}
+		return fileFn(root)
+	}
+
+	var matcher *IgnoreMatcher
+	if !noIgnore {
+		matcher, err = NewIgnoreMatcher(absRoot)
+		if err != nil {
+			return err
+		}
+	}
+
+	return filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if matcher != nil && path != root {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			absPath := filepath.Join(absRoot, rel)
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if matcher.Match(absPath, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if info.IsDir() {
+			if dirFn != nil {
+				if err := dirFn(path); err != nil {
+					return err
+				}
+			}
+			if matcher != nil {
+				return matcher.addPatternsFromDir(path)
+			}
+			return nil
+		}
+		if fileFn == nil {
+			return nil
+		}
+		return fileFn(path)
+	})
+}
+
+// IsIgnored reports whether path is excluded by the same ignore files WalkFiles respects
+func IsIgnored(path string, isDir bool) (bool, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	// Passing the path as the root loads the ignore files of every directory containing it
+	matcher, err := NewIgnoreMatcher(absPath)
+	if err != nil {
+		return false, err
+	}
+	ignored := matcher.Match(absPath, isDir)
+	if repoRoot, ok := findRepoRoot(absPath); ok {
+		for dir := filepath.Dir(absPath); !ignored && dir != repoRoot && strings.HasPrefix(dir, repoRoot); dir = filepath.Dir(dir) {
+			ignored = matcher.Match(dir, true)
+		}
+	}
+	return ignored, nil
+}
+
+// FilterIgnoredPaths drops ignored files from lists that don't come from walking a directory
+func FilterIgnoredPaths(paths []string) ([]string, error) {
+	var kept []string
+	for _, path := range paths {
+		ignored, err := IsIgnored(path, false)
+		if err != nil {
+			return nil, err
+		}
+		if !ignored {
+			kept = append(kept, path)
+		}
+	}
+	return kept, nil
+}
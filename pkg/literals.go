@@ -0,0 +1,195 @@
+package polylint
+
+// literalMatcher finds many literal patterns in a single pass over the text with an
+// Aho-Corasick automaton. It is immutable once built, so forks of a config share it.
+type literalMatcher struct {
+	patterns []string
+	indexes  map[string]int
+	nodes    []acNode
+}
+
+type acNode struct {
+	next map[byte]int32
+	// fail is the node of the longest proper suffix of this node that is also in the trie
+	fail int32
+	// out are the patterns ending at this node, including those ending at its fail nodes
+	out []int32
+}
+
+func newLiteralMatcher(patterns []string) *literalMatcher {
+	m := &literalMatcher{indexes: make(map[string]int), nodes: []acNode{{}}}
+	for _, pattern := range patterns {
+		if _, ok := m.indexes[pattern]; ok || pattern == "" {
+			continue
+		}
+		m.indexes[pattern] = len(m.patterns)
+		m.patterns = append(m.patterns, pattern)
+
+		node := int32(0)
+		for i := 0; i < len(pattern); i++ {
+			next, ok := m.nodes[node].next[pattern[i]]
+			if !ok {
+				if m.nodes[node].next == nil {
+					m.nodes[node].next = make(map[byte]int32)
+				}
+				next = int32(len(m.nodes))
+				m.nodes[node].next[pattern[i]] = next
+				m.nodes = append(m.nodes, acNode{})
+			}
+			node = next
+		}
+		m.nodes[node].out = append(m.nodes[node].out, int32(m.indexes[pattern]))
+	}
+
+	// Fail links are set breadth first so that every shorter suffix is resolved first
+	queue := make([]int32, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for c, child := range m.nodes[node].next {
+			fail := m.nodes[node].fail
+			for fail != 0 && !m.hasNext(fail, c) {
+				fail = m.nodes[fail].fail
+			}
+			if next, ok := m.nodes[fail].next[c]; ok && next != child {
+				fail = next
+			}
+			m.nodes[child].fail = fail
+			m.nodes[child].out = append(m.nodes[child].out, m.nodes[fail].out...)
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+func (m *literalMatcher) hasNext(node int32, c byte) bool {
+	_, ok := m.nodes[node].next[c]
+	return ok
+}
+
+// index returns the index of pattern in the results of matches
+func (m *literalMatcher) index(pattern string) (int, bool) {
+	if m == nil {
+		return 0, false
+	}
+	idx, ok := m.indexes[pattern]
+	return idx, ok
+}
+
+// matches returns the occurrences of each pattern by index, without overlapping occurrences of
+// the same pattern, which is what containsMatches returns for each pattern alone. It returns
+// nil when no pattern occurs in text.
+func (m *literalMatcher) matches(text string) map[int][]Match {
+	var hits map[int][]Match
+	node := int32(0)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		for node != 0 && !m.hasNext(node, c) {
+			node = m.nodes[node].fail
+		}
+		if next, ok := m.nodes[node].next[c]; ok {
+			node = next
+		}
+		for _, p := range m.nodes[node].out {
+			start := i + 1 - len(m.patterns[p])
+			previous := hits[int(p)]
+			if len(previous) > 0 && start < previous[len(previous)-1].Range.End {
+				continue
+			}
+			if hits == nil {
+				hits = make(map[int][]Match)
+			}
+			hits[int(p)] = append(previous, Match{Range: &Range{Start: start, End: i + 1}})
+		}
+	}
+	return hits
+}
+
+// literalPattern returns the text of a builtin contains rule when it can be merged into a
+// literalMatcher, which excludes empty patterns and those ignoring case
+func literalPattern(f RawFn) (string, bool) {
+	if FnType(f.Type) != builtinType || f.Name != "contains" || (f.Scope != lineScope && f.Scope != fileScope) {
+		return "", false
+	}
+	f, _ = withoutLegacyArgs(f)
+	args, err := resolveArgs(f, containsArgs)
+	if err != nil || args.bool("ignore_case") || args.string("pattern") == "" {
+		return "", false
+	}
+	return args.string("pattern"), true
+}
+
+// buildLiteralMatcher merges the literal contains rules of the config and its overrides into
+// one automaton so each line is scanned once however many of them there are
+func buildLiteralMatcher(config ConfigFile) *literalMatcher {
+	var patterns []string
+	for _, rule := range config.Rules {
+		if rule.literal != "" {
+			patterns = append(patterns, rule.literal)
+		}
+	}
+	for _, override := range config.Overrides {
+		for _, ruleOverride := range override.Rules {
+			if ruleOverride.literal != "" {
+				patterns = append(patterns, ruleOverride.literal)
+			}
+		}
+	}
+	// A single pattern is found as quickly by its own rule
+	if len(patterns) < 2 {
+		return nil
+	}
+	return newLiteralMatcher(patterns)
+}
+
+// ruleSet are the rules whose include_paths and exclude_paths select a file, along with the
+// literal matcher shared by its literal contains rules
+type ruleSet struct {
+	rules    []Rule
+	literals *literalMatcher
+	// literalIdx is the index of each rule's pattern in literals, or -1 to call its Fn
+	literalIdx []int
+}
+
+func newRuleSet(rules []Rule, literals *literalMatcher, path string) *ruleSet {
+	s := &ruleSet{literals: literals}
+	for _, rule := range rules {
+		// Start with strictest, which is denies
+		if rule.ExcludePaths != nil && rule.ExcludePaths.MatchString(path) {
+			continue
+		}
+		if rule.IncludePaths == nil || !rule.IncludePaths.MatchString(path) {
+			continue
+		}
+		patternIdx, ok := literals.index(rule.literal)
+		if !ok || rule.literal == "" {
+			patternIdx = -1
+		}
+		s.rules = append(s.rules, rule)
+		s.literalIdx = append(s.literalIdx, patternIdx)
+	}
+	return s
+}
+
+// ruleScan runs rules over one line or file, scanning it for the literal patterns at most once
+type ruleScan struct {
+	set     *ruleSet
+	text    string
+	hits    map[int][]Match
+	scanned bool
+}
+
+func (s *ruleScan) matches(ruleIdx int, path string, idx int) []Match {
+	patternIdx := s.set.literalIdx[ruleIdx]
+	if patternIdx < 0 {
+		return s.set.rules[ruleIdx].Fn(path, idx, s.text)
+	}
+	if !s.scanned {
+		s.hits = s.set.literals.matches(s.text)
+		s.scanned = true
+	}
+	return s.hits[patternIdx]
+}
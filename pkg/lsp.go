@@ -0,0 +1,572 @@
+package polylint
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// LSP error codes from the JSON-RPC and Language Server Protocol specifications
+const (
+	lspParseError     = -32700
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+	lspNotInitialized = -32002
+)
+
+// LSP DiagnosticSeverity and MessageType values
+const (
+	lspSeverityError       = 1
+	lspSeverityWarning     = 2
+	lspSeverityInformation = 3
+	lspSeverityHint        = 4
+
+	lspMessageError = 1
+)
+
+type lspMessage struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method,omitempty"`
+	Params json.RawMessage  `json:"params,omitempty"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspCodeDescription struct {
+	Href string `json:"href"`
+}
+
+// lspDiagnosticData is round tripped through the client so code actions know the rule scope
+type lspDiagnosticData struct {
+	RuleId string `json:"rule_id"`
+	Scope  Scope  `json:"scope"`
+}
+
+type lspDiagnostic struct {
+	Range           lspRange            `json:"range"`
+	Severity        int                 `json:"severity"`
+	Code            string              `json:"code,omitempty"`
+	CodeDescription *lspCodeDescription `json:"codeDescription,omitempty"`
+	Source          string              `json:"source"`
+	Message         string              `json:"message"`
+	Data            *lspDiagnosticData  `json:"data,omitempty"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspCodeAction struct {
+	Title       string          `json:"title"`
+	Kind        string          `json:"kind"`
+	Diagnostics []lspDiagnostic `json:"diagnostics"`
+	Edit        struct {
+		Changes map[string][]lspTextEdit `json:"changes"`
+	} `json:"edit"`
+}
+
+type lspTextDocumentItem struct {
+	URI     string `json:"uri"`
+	Text    string `json:"text"`
+	Version int    `json:"version"`
+}
+
+type lspDidOpenParams struct {
+	TextDocument lspTextDocumentItem `json:"textDocument"`
+}
+
+type lspDidChangeParams struct {
+	TextDocument   lspTextDocumentItem `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type lspDocumentParams struct {
+	TextDocument lspTextDocumentItem `json:"textDocument"`
+}
+
+type lspDidChangeWatchedFilesParams struct {
+	Changes []struct {
+		URI string `json:"uri"`
+	} `json:"changes"`
+}
+
+type lspCodeActionParams struct {
+	TextDocument lspTextDocumentItem `json:"textDocument"`
+	Context      struct {
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	} `json:"context"`
+}
+
+type lspInitializeParams struct {
+	RootURI      string `json:"rootUri"`
+	Capabilities struct {
+		Workspace struct {
+			DidChangeWatchedFiles struct {
+				DynamicRegistration bool `json:"dynamicRegistration"`
+			} `json:"didChangeWatchedFiles"`
+		} `json:"workspace"`
+	} `json:"capabilities"`
+}
+
+// LSPServer publishes findings as diagnostics to an editor over the Language Server Protocol.
+// Messages are handled one at a time, so the goja and extism runtimes in the config are only
+// ever used from a single goroutine.
+type LSPServer struct {
+	in  *bufio.Reader
+	out io.Writer
+	// writeMu serializes messages written to out
+	writeMu sync.Mutex
+
+	loadConfig func() (ConfigFile, error)
+	cfg        ConfigFile
+	// configName is the file name of the config, changes to it reload the rules
+	configName string
+
+	root        string
+	docs        map[string]string
+	initialized bool
+	// watchConfig is set when the client can register file watchers for the config
+	watchConfig bool
+	shutdown    bool
+	nextID      int
+}
+
+// NewLSPServer creates a server reading from in and writing to out. loadConfig is called on
+// startup and whenever a file named configName changes.
+func NewLSPServer(in io.Reader, out io.Writer, configName string, loadConfig func() (ConfigFile, error)) *LSPServer {
+	root, _ := os.Getwd()
+	return &LSPServer{
+		in:         bufio.NewReader(in),
+		out:        out,
+		loadConfig: loadConfig,
+		configName: configName,
+		root:       root,
+		docs:       make(map[string]string),
+	}
+}
+
+// Serve handles messages until the client sends exit or closes the stream. The returned
+// error is nil only for an exit that follows a shutdown request.
+func (s *LSPServer) Serve() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return fmt.Errorf("client closed the connection without exiting")
+		}
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			s.replyError(nil, lspParseError, "invalid message")
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		s.handle(msg)
+	}
+}
+
+// read returns the next message, or nil when its body isn't valid JSON
+func (s *LSPServer) read() (*lspMessage, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %v", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	var msg lspMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, nil
+	}
+	return &msg, nil
+}
+
+func (s *LSPServer) write(msg map[string]any) {
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		logz.Errorf("error encoding lsp message: %v", err)
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *LSPServer) reply(id *json.RawMessage, result any) {
+	s.write(map[string]any{"id": id, "result": result})
+}
+
+func (s *LSPServer) replyError(id *json.RawMessage, code int, message string) {
+	s.write(map[string]any{"id": id, "error": map[string]any{"code": code, "message": message}})
+}
+
+func (s *LSPServer) notify(method string, params any) {
+	s.write(map[string]any{"method": method, "params": params})
+}
+
+func (s *LSPServer) request(method string, params any) {
+	s.nextID++
+	s.write(map[string]any{"id": s.nextID, "method": method, "params": params})
+}
+
+func (s *LSPServer) showError(format string, args ...any) {
+	s.notify("window/showMessage", map[string]any{"type": lspMessageError, "message": fmt.Sprintf(format, args...)})
+}
+
+func (s *LSPServer) handle(msg *lspMessage) {
+	// Responses to our own requests carry an id but no method
+	if msg.Method == "" {
+		return
+	}
+	isRequest := msg.ID != nil
+	if !s.initialized && msg.Method != "initialize" {
+		if isRequest {
+			s.replyError(msg.ID, lspNotInitialized, "server not initialized")
+		}
+		return
+	}
+
+	var err error
+	switch msg.Method {
+	case "initialize":
+		err = s.initialize(msg)
+	case "initialized":
+		// Ask the client to tell us about config changes, clients without dynamic
+		// registration still reload through didSave
+		if !s.watchConfig {
+			break
+		}
+		s.request("client/registerCapability", map[string]any{
+			"registrations": []map[string]any{{
+				"id":     "polylint-config",
+				"method": "workspace/didChangeWatchedFiles",
+				"registerOptions": map[string]any{
+					"watchers": []map[string]any{{"globPattern": "**/" + s.configName}},
+				},
+			}},
+		})
+	case "shutdown":
+		s.shutdown = true
+		s.reply(msg.ID, nil)
+	case "textDocument/didOpen":
+		var params lspDidOpenParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			s.docs[params.TextDocument.URI] = params.TextDocument.Text
+			s.publish(params.TextDocument.URI)
+		}
+	case "textDocument/didChange":
+		var params lspDidChangeParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil && len(params.ContentChanges) > 0 {
+			// Full document sync, the last change holds the whole text
+			s.docs[params.TextDocument.URI] = params.ContentChanges[len(params.ContentChanges)-1].Text
+			s.publish(params.TextDocument.URI)
+		}
+	case "textDocument/didSave":
+		var params lspDocumentParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil && s.isConfig(params.TextDocument.URI) {
+			s.reload()
+		}
+	case "textDocument/didClose":
+		var params lspDocumentParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			delete(s.docs, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", map[string]any{"uri": params.TextDocument.URI, "diagnostics": []lspDiagnostic{}})
+		}
+	case "workspace/didChangeWatchedFiles":
+		var params lspDidChangeWatchedFilesParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			for _, change := range params.Changes {
+				if s.isConfig(change.URI) {
+					s.reload()
+					break
+				}
+			}
+		}
+	case "textDocument/codeAction":
+		var params lspCodeActionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			s.reply(msg.ID, s.codeActions(params))
+		}
+	default:
+		if isRequest {
+			s.replyError(msg.ID, lspMethodNotFound, fmt.Sprintf("method not found: %s", msg.Method))
+		}
+		return
+	}
+
+	if err != nil && isRequest {
+		s.replyError(msg.ID, lspInvalidParams, err.Error())
+	} else if err != nil {
+		logz.Warnf("invalid params for %s: %v", msg.Method, err)
+	}
+}
+
+func (s *LSPServer) initialize(msg *lspMessage) error {
+	var params lspInitializeParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return err
+	}
+	if path, ok := uriToPath(params.RootURI); ok {
+		s.root = path
+	}
+	s.watchConfig = params.Capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration
+
+	s.initialized = true
+	s.reply(msg.ID, map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync": map[string]any{
+				"openClose": true,
+				// Full document sync
+				"change": 1,
+				"save":   true,
+			},
+			"codeActionProvider": map[string]any{"codeActionKinds": []string{"quickfix"}},
+		},
+		"serverInfo": map[string]any{"name": "polylint"},
+	})
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		s.showError("polylint: error loading config: %v", err)
+	}
+	s.cfg = cfg
+	return nil
+}
+
+func (s *LSPServer) isConfig(uri string) bool {
+	path, ok := uriToPath(uri)
+	return ok && filepath.Base(path) == s.configName
+}
+
+// reload rebuilds the rules and re-lints every open document. An invalid config is reported
+// and the previous rules are kept.
+func (s *LSPServer) reload() {
+	cfg, err := s.loadConfig()
+	if err != nil {
+		s.showError("polylint: error reloading config, keeping the previous rules: %v", err)
+		return
+	}
+	s.cfg = cfg
+
+	uris := make([]string, 0, len(s.docs))
+	for uri := range s.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		s.publish(uri)
+	}
+}
+
+// relativePath matches the paths the run command lints, relative to the workspace root
+func (s *LSPServer) relativePath(uri string) string {
+	path, ok := uriToPath(uri)
+	if !ok {
+		return uri
+	}
+	if rel, err := filepath.Rel(s.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+func (s *LSPServer) publish(uri string) {
+	content := s.docs[uri]
+	diagnostics := []lspDiagnostic{}
+	report, err := ProcessFile(content, s.relativePath(uri), s.cfg)
+	if err != nil {
+		s.showError("polylint: error linting %s: %v", uri, err)
+	} else {
+		lineStarts := lineStartOffsets(content)
+		for _, finding := range report.Findings {
+			diagnostics = append(diagnostics, diagnosticFor(finding, content, lineStarts))
+		}
+		for _, warning := range report.Warnings {
+			position := lspPosition{Line: warning.LineNo - 1}
+			diagnostics = append(diagnostics, lspDiagnostic{
+				Range:    lspRange{Start: position, End: position},
+				Severity: lspSeverityWarning,
+				Source:   "polylint",
+				Message:  warning.Message,
+			})
+		}
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+}
+
+func lspSeverity(s SeverityLevel) int {
+	switch s {
+	case highSeverity:
+		return lspSeverityError
+	case mediumSeverity:
+		return lspSeverityWarning
+	case lowSeverity:
+		return lspSeverityInformation
+	default:
+		return lspSeverityHint
+	}
+}
+
+func diagnosticFor(finding Finding, content string, lineStarts []int) lspDiagnostic {
+	message := finding.Rule.Description
+	if finding.Message != "" && message != "" {
+		message = fmt.Sprintf("%s: %s", message, finding.Message)
+	} else if finding.Message != "" {
+		message = finding.Message
+	}
+
+	d := lspDiagnostic{
+		Severity: lspSeverity(finding.Severity),
+		Code:     finding.RuleId,
+		Source:   "polylint",
+		Message:  message,
+		Data:     &lspDiagnosticData{RuleId: finding.RuleId, Scope: finding.Rule.Scope},
+	}
+	if finding.Rule.Link != "" {
+		d.CodeDescription = &lspCodeDescription{Href: finding.Rule.Link}
+	}
+	switch {
+	case finding.Range != nil:
+		d.Range = lspRange{
+			Start: positionAt(content, lineStarts, finding.Range.Start),
+			End:   positionAt(content, lineStarts, finding.Range.End),
+		}
+	case finding.LineNo > 0 && finding.LineNo <= len(lineStarts):
+		start := positionAt(content, lineStarts, lineStarts[finding.LineNo-1])
+		end := start
+		end.Character = utf16Len(strings.TrimSuffix(finding.Line, "\r"))
+		d.Range = lspRange{Start: start, End: end}
+	}
+	return d
+}
+
+func lineStartOffsets(content string) []int {
+	starts := []int{0}
+	for idx := 0; idx < len(content); idx++ {
+		if content[idx] == '\n' {
+			starts = append(starts, idx+1)
+		}
+	}
+	return starts
+}
+
+// positionAt converts a byte offset into a zero based line and UTF-16 character position
+func positionAt(content string, lineStarts []int, offset int) lspPosition {
+	if offset > len(content) {
+		offset = len(content)
+	}
+	line := sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > offset }) - 1
+	return lspPosition{Line: line, Character: utf16Len(content[lineStarts[line]:offset])}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		n += len(utf16.Encode([]rune{r}))
+		s = s[size:]
+	}
+	return n
+}
+
+// commentSyntax is the line comment prefix and suffix for a file extension
+var commentSyntax = map[string][2]string{
+	".go": {"//", ""}, ".js": {"//", ""}, ".jsx": {"//", ""}, ".mjs": {"//", ""}, ".ts": {"//", ""},
+	".tsx": {"//", ""}, ".java": {"//", ""}, ".kt": {"//", ""}, ".swift": {"//", ""}, ".c": {"//", ""},
+	".h": {"//", ""}, ".cpp": {"//", ""}, ".cc": {"//", ""}, ".hpp": {"//", ""}, ".cs": {"//", ""},
+	".rs": {"//", ""}, ".scala": {"//", ""}, ".php": {"//", ""}, ".dart": {"//", ""}, ".proto": {"//", ""},
+	".sql": {"--", ""}, ".lua": {"--", ""}, ".hs": {"--", ""},
+	".clj": {";", ""}, ".el": {";", ""}, ".ini": {";", ""},
+	".html": {"<!--", " -->"}, ".xml": {"<!--", " -->"}, ".md": {"<!--", " -->"},
+	".css": {"/*", " */"},
+}
+
+// ignoreComment renders a polylint directive as a comment in the language of path, defaulting
+// to # comments
+func ignoreComment(path, directive string) string {
+	syntax, ok := commentSyntax[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		syntax = [2]string{"#", ""}
+	}
+	return fmt.Sprintf("%s polylint %s%s", syntax[0], directive, syntax[1])
+}
+
+// codeActions offers to disable the rule behind each polylint diagnostic, on the next line for
+// line scoped rules and for the whole file otherwise
+func (s *LSPServer) codeActions(params lspCodeActionParams) []lspCodeAction {
+	uri := params.TextDocument.URI
+	lines := strings.Split(s.docs[uri], "\n")
+	actions := []lspCodeAction{}
+	for _, d := range params.Context.Diagnostics {
+		if d.Source != "polylint" || d.Data == nil {
+			continue
+		}
+		var title, text string
+		line := 0
+		if d.Data.Scope == lineScope {
+			line = d.Range.Start.Line
+			if line < len(lines) {
+				text = lines[line][:len(lines[line])-len(strings.TrimLeft(lines[line], " \t"))]
+			}
+			title = fmt.Sprintf("Disable %s for this line", d.Data.RuleId)
+			text += ignoreComment(s.relativePath(uri), "disable-next-line="+d.Data.RuleId)
+		} else {
+			// Keep shebangs on the first line
+			if len(lines) > 0 && strings.HasPrefix(lines[0], "#!") {
+				line = 1
+			}
+			title = fmt.Sprintf("Disable %s for this file", d.Data.RuleId)
+			text = ignoreComment(s.relativePath(uri), "disable-for-file="+d.Data.RuleId)
+		}
+
+		action := lspCodeAction{Title: title, Kind: "quickfix", Diagnostics: []lspDiagnostic{d}}
+		position := lspPosition{Line: line}
+		action.Edit.Changes = map[string][]lspTextEdit{
+			uri: {{Range: lspRange{Start: position, End: position}, NewText: text + "\n"}},
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// uriToPath converts a file:// URI to a local path
+func uriToPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
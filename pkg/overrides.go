@@ -0,0 +1,166 @@
+package polylint
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// overrideBase is the directory the globs of a config's overrides are relative to, the
+// config's own directory when it is local and the working directory otherwise
+func overrideBase(source string) string {
+	if u, err := url.Parse(source); source != "" && err == nil && (u.Scheme == "" || u.Scheme == "file") {
+		if absPath, err := filepath.Abs(u.Path); err == nil {
+			return filepath.Dir(absPath)
+		}
+	}
+	base, _ := os.Getwd()
+	return base
+}
+
+// overrideGlob compiles a glob the way .gitignore patterns are, so a glob without a slash
+// matches files at any depth
+func overrideGlob(glob string) (*regexp.Regexp, error) {
+	if strings.Contains(glob, "/") {
+		glob = strings.TrimPrefix(glob, "/")
+	} else {
+		glob = "**/" + glob
+	}
+	return globToRegexp(glob)
+}
+
+// buildOverrides validates the overrides of a config against its rules, which include the
+// rules of its includes, and builds the functions of overrides that change args
+func buildOverrides(rawOverrides []RawOverride, rules []Rule, source string, positions configPositions) ([]Override, ConfigErrors) {
+	var errs ConfigErrors
+	rulesById := make(map[string]Rule, len(rules))
+	for _, rule := range rules {
+		rulesById[rule.Id] = rule
+	}
+
+	var overrides []Override
+	base := overrideBase(source)
+	for idx, raw := range rawOverrides {
+		overrideErr := func(ruleId string, err error, keys ...string) {
+			line, col := positions.override(idx, keys...)
+			errs = append(errs, &ConfigError{RuleId: ruleId, Source: source, Line: line, Column: col, Err: err})
+		}
+
+		override := Override{Files: raw.Files, base: base, Rules: make(map[string]RuleOverride, len(raw.Rules))}
+		if len(raw.Files) == 0 {
+			overrideErr("", errors.New("override requires at least one glob in files"))
+		}
+		for _, glob := range raw.Files {
+			re, err := overrideGlob(glob)
+			if err != nil {
+				overrideErr("", fmt.Errorf("invalid glob %q: %v", glob, err), "files")
+				continue
+			}
+			override.patterns = append(override.patterns, re)
+		}
+
+		// Sorted so that errors are reported in a stable order
+		ids := make([]string, 0, len(raw.Rules))
+		for id := range raw.Rules {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			rawRule := raw.Rules[id]
+			rule, ok := rulesById[id]
+			if !ok {
+				overrideErr("", fmt.Errorf("override of unknown rule %s", id), "rules", id)
+				continue
+			}
+			ruleOverride := RuleOverride{Off: rawRule.Off}
+			if rawRule.Severity != "" {
+				severity, err := ParseSeverityLevel(rawRule.Severity)
+				if err != nil {
+					overrideErr(id, err, "rules", id)
+					continue
+				}
+				ruleOverride.Severity = severity
+			}
+			if rawRule.Args != nil {
+				ruleOverride.source = rule.source
+				ruleOverride.source.Args = rule.source.Args.withOverride(*rawRule.Args)
+				fn, err := BuildFn(ruleOverride.source)
+				if err != nil {
+					overrideErr(id, err, "rules", id)
+					continue
+				}
+				ruleOverride.Fn = fn
+				ruleOverride.literal, _ = literalPattern(ruleOverride.source)
+			}
+			override.Rules[id] = ruleOverride
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, errs
+}
+
+// matches reports whether the absolute path is below the override's base and matches one of
+// its globs
+func (o Override) matches(absPath string) bool {
+	rel, err := filepath.Rel(o.base, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, re := range o.patterns {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesFor returns the rules with the overrides matching path applied. Rules turned off are
+// left out, unless a later override sets them again.
+func (c ConfigFile) rulesFor(path string) []Rule {
+	if len(c.Overrides) == 0 {
+		return c.Rules
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return c.Rules
+	}
+	var matching []Override
+	for _, override := range c.Overrides {
+		if override.matches(absPath) {
+			matching = append(matching, override)
+		}
+	}
+	if len(matching) == 0 {
+		return c.Rules
+	}
+
+	rules := make([]Rule, 0, len(c.Rules))
+	for _, rule := range c.Rules {
+		off := false
+		for _, override := range matching {
+			ruleOverride, ok := override.Rules[rule.Id]
+			if !ok {
+				continue
+			}
+			off = ruleOverride.Off
+			if ruleOverride.Severity != unknownSeverity {
+				rule.Severity = ruleOverride.Severity
+			}
+			if ruleOverride.Fn != nil {
+				rule.Fn = ruleOverride.Fn
+				rule.source = ruleOverride.source
+				rule.literal = ruleOverride.literal
+			}
+		}
+		if !off {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
@@ -4,15 +4,17 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/dop251/goja"
 	extism "github.com/extism/go-sdk"
@@ -21,54 +23,215 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
-// TODO: use more efficient data structure... like map[int]Ignore where int = line number
-func extractIgnoresFromLine(line string, lineNo int, f *FileReport) error {
-	if strings.Contains(line, "polylint disable") {
-		chunks := strings.SplitN(line, "=", 2)
-		directive := strings.TrimSpace(strings.SplitN(chunks[0], "polylint", 2)[1])
-		ignoresStr := strings.TrimSpace(chunks[1])
-		if directive == "disable-for-file" {
-			ignores := strings.Split(ignoresStr, ",")
-			for _, ignore := range ignores {
-				f.Ignores = append(f.Ignores, Ignore{Scope: fileScope, SourceLineNo: lineNo, LineNo: 0, Id: ignore})
+var directivePattern = regexp.MustCompile(`polylint\s+((?:disable|enable)[\w-]*)(?:\s*=\s*([\w.*?\[\]/-]+(?:\s*,\s*[\w.*?\[\]/-]+)*))?(?:\s+--\s*(.*))?`)
+
+// parseDirective extracts a polylint directive, its rule ids and the reason given after --
+func parseDirective(line string) (string, []string, string, bool) {
+	m := directivePattern.FindStringSubmatch(line)
+	if m == nil {
+		return "", nil, "", false
+	}
+	var ids []string
+	for _, id := range strings.Split(m[2], ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	// Drop the end of block comments such as */ and -->
+	reason := strings.TrimSpace(m[3])
+	for _, end := range []string{"*/", "-->"} {
+		reason = strings.TrimSpace(strings.TrimSuffix(reason, end))
+	}
+	return m[1], ids, reason, true
+}
+
+// extractIgnores parses the directives of every line before any rule runs, since a disable
+// block only becomes a block once its enable is found
+func extractIgnores(lines []string, f *FileReport) {
+	type openBlock struct {
+		id     string
+		lineNo int
+		reason string
+	}
+	var open []openBlock
+	warn := func(lineNo int, format string, args ...any) {
+		f.Warnings = append(f.Warnings, Warning{LineNo: lineNo, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for idx, line := range lines {
+		lineNo := idx + 1
+		directive, ids, reason, ok := parseDirective(line)
+		if !ok {
+			continue
+		}
+		if directive == "disable-all" || directive == "enable-all" {
+			directive = strings.TrimSuffix(directive, "-all")
+			ids = []string{"*"}
+		}
+		if len(ids) == 0 {
+			warn(lineNo, "polylint %s is missing the rule ids to apply to", directive)
+			continue
+		}
+
+		switch directive {
+		case "disable-for-file":
+			for _, id := range ids {
+				f.Ignores = append(f.Ignores, Ignore{Scope: fileScope, SourceLineNo: lineNo, LineNo: 0, Id: id, Reason: reason})
 			}
-		} else if directive == "disable-next-line" || directive == "disable-line" || directive == "disable" {
-			ignores := strings.Split(ignoresStr, ",")
-			for _, ignore := range ignores {
-				nextLineNo := lineNo + 1
-				f.Ignores = append(f.Ignores, Ignore{Scope: lineScope, SourceLineNo: lineNo, LineNo: nextLineNo, Id: ignore})
+		case "disable-for-path":
+			for _, id := range ids {
+				f.Ignores = append(f.Ignores, Ignore{Scope: pathScope, SourceLineNo: lineNo, LineNo: 0, Id: id, Reason: reason})
 			}
-		} else if directive == "disable-for-path" {
-			ignores := strings.Split(ignoresStr, ",")
-			for _, ignore := range ignores {
-				f.Ignores = append(f.Ignores, Ignore{Scope: pathScope, SourceLineNo: lineNo, LineNo: 0, Id: ignore})
+		case "disable-next-line", "disable-line":
+			for _, id := range ids {
+				f.Ignores = append(f.Ignores, Ignore{Scope: lineScope, SourceLineNo: lineNo, LineNo: lineNo + 1, EndLineNo: lineNo + 1, Id: id, Reason: reason})
 			}
-		} else {
-			logz.Warnf("WARNING: directive for polylint not recognized on line %d %s %s\n", lineNo, directive, ignoresStr)
-			return nil
+		case "disable":
+			for _, id := range ids {
+				open = append(open, openBlock{id: id, lineNo: lineNo, reason: reason})
+			}
+		case "enable":
+			for _, id := range ids {
+				closed := false
+				remaining := open[:0]
+				for _, block := range open {
+					if id != "*" && block.id != id {
+						remaining = append(remaining, block)
+						continue
+					}
+					f.Ignores = append(f.Ignores, Ignore{Scope: lineScope, SourceLineNo: block.lineNo, LineNo: block.lineNo + 1, EndLineNo: lineNo - 1, Id: block.id, Reason: block.reason})
+					closed = true
+				}
+				open = remaining
+				if !closed {
+					warn(lineNo, "polylint enable=%s has no matching disable=%s", id, id)
+				}
+			}
+		default:
+			warn(lineNo, "polylint %s is not a recognized directive", directive)
 		}
 	}
-	return nil
+
+	// Before blocks existed disable= only applied to the next line, unclosed blocks keep doing so
+	for _, block := range open {
+		f.Ignores = append(f.Ignores, Ignore{Scope: lineScope, SourceLineNo: block.lineNo, LineNo: block.lineNo + 1, EndLineNo: block.lineNo + 1, Id: block.id, Reason: block.reason})
+		warn(block.lineNo, "polylint disable=%s is never closed by enable=%s, only the next line is disabled", block.id, block.id)
+	}
+	sort.SliceStable(f.Warnings, func(i, j int) bool {
+		return f.Warnings[i].LineNo < f.Warnings[j].LineNo
+	})
+	for idx := range f.Ignores {
+		f.Ignores[idx].SourceLine = lines[f.Ignores[idx].SourceLineNo-1]
+	}
+}
+
+// Rules for problems with ignore directives themselves, reported alongside configured rules
+var (
+	missingIgnoreReasonRule = Rule{
+		Id:             "polylint/missing-ignore-reason",
+		Description:    "Ignore directives must explain why the rule doesn't apply",
+		Recommendation: "Add a reason after the rule ids, e.g. polylint disable-next-line=<id> -- <reason>",
+		Severity:       lowSeverity,
+		Scope:          lineScope,
+	}
+	unusedIgnoreRule = Rule{
+		Id:             "polylint/unused-ignore",
+		Description:    "Ignore directive doesn't suppress any finding",
+		Recommendation: "Remove the directive or correct its rule ids",
+		Severity:       lowSeverity,
+		Scope:          lineScope,
+	}
+	directiveRules = map[string]Rule{
+		missingIgnoreReasonRule.Id: missingIgnoreReasonRule,
+		unusedIgnoreRule.Id:        unusedIgnoreRule,
+	}
+)
+
+func directiveFinding(rule Rule, f *FileReport, lineNo int, line string, message string) Finding {
+	return Finding{
+		Path:      f.Path,
+		Line:      line,
+		LineIndex: lineNo - 1,
+		LineNo:    lineNo,
+		Rule:      rule,
+		RuleId:    rule.Id,
+		Message:   message,
+		Severity:  rule.Severity,
+	}
 }
 
-func getIgnoresForLine(f *FileReport, lineNo int) map[string]Ignore {
-	var ignores = make(map[string]Ignore)
+// missingReasonFindings reports each directive line whose ignores have no reason
+func missingReasonFindings(f *FileReport) []Finding {
+	var findings []Finding
+	reported := make(map[int]bool)
 	for _, ignore := range f.Ignores {
-		if ignore.Scope == lineScope && ignore.LineNo == lineNo {
-			ignores[ignore.Id] = ignore
-		} else if ignore.Scope == fileScope {
-			ignores[ignore.Id] = ignore
+		if ignore.Reason != "" || reported[ignore.SourceLineNo] {
+			continue
 		}
+		reported[ignore.SourceLineNo] = true
+		message := fmt.Sprintf("Ignore of %s has no reason, add one after --", ignore.Id)
+		findings = append(findings, directiveFinding(missingIgnoreReasonRule, f, ignore.SourceLineNo, ignore.SourceLine, message))
 	}
-	return ignores
+	return findings
 }
 
-func processLine(line string, idx int, f *FileReport) error {
-	lineNo := idx + 1
-	if err := extractIgnoresFromLine(line, lineNo, f); err != nil {
-		return err
+// ReportUnusedIgnores adds a finding for every ignore that didn't suppress any finding
+func ReportUnusedIgnores(reports []FileReport) []FileReport {
+	for idx := range reports {
+		report := &reports[idx]
+		for _, ignore := range report.Ignores {
+			if ignore.Hits > 0 {
+				continue
+			}
+			message := fmt.Sprintf("Ignore of %s doesn't suppress any finding", ignore.Id)
+			finding := directiveFinding(unusedIgnoreRule, report, ignore.SourceLineNo, ignore.SourceLine, message)
+			report.Findings = append(report.Findings, finding)
+		}
 	}
-	ignores := getIgnoresForLine(f, lineNo)
+	return reports
+}
+
+// ignoreFor returns the ignore that suppresses finding, or nil. disable-for-file applies to
+// every rule, disable-for-path to path scoped rules, and line ignores to the line findings and
+// file findings that point at one of their lines.
+func ignoreFor(f *FileReport, finding Finding) *Ignore {
+	for idx := range f.Ignores {
+		ignore := &f.Ignores[idx]
+		if !ignore.Matches(finding.RuleId) {
+			continue
+		}
+		switch ignore.Scope {
+		case fileScope:
+			return ignore
+		case pathScope:
+			if finding.Rule.Scope == pathScope {
+				return ignore
+			}
+		case lineScope:
+			if finding.Rule.Scope != pathScope && finding.LineNo >= ignore.LineNo && finding.LineNo <= ignore.EndLineNo {
+				return ignore
+			}
+		}
+	}
+	return nil
+}
+
+// addFinding records finding, or moves it to Suppressed along with the directive that
+// suppressed it. Ignored rules still run so that ignores which never suppress anything can
+// be reported.
+func addFinding(f *FileReport, finding Finding) {
+	ignore := ignoreFor(f, finding)
+	if ignore == nil {
+		f.Findings = append(f.Findings, finding)
+		return
+	}
+	ignore.Hits++
+	finding.SuppressedBy = &Suppression{Id: ignore.Id, Scope: ignore.Scope, SourceLineNo: ignore.SourceLineNo, Reason: ignore.Reason}
+	f.Suppressed = append(f.Suppressed, finding)
+}
+
+func processLine(line string, idx int, f *FileReport, set *ruleSet) error {
+	lineNo := idx + 1
 
 	// Ignore declaration lines of lint rules which requires that we not support
 	// end of line polylint ignore declarations
@@ -76,44 +239,63 @@ func processLine(line string, idx int, f *FileReport) error {
 		return nil
 	}
 
-	for _, rule := range f.Rules {
+	scan := ruleScan{set: set, text: line}
+	for ruleIdx, rule := range set.rules {
 		if rule.Scope != lineScope {
 			continue
 		}
-		// Start with strictest, which is denies
-		if rule.ExcludePaths != nil && rule.ExcludePaths.MatchString(f.Path) {
-			continue
-		}
-		if rule.IncludePaths != nil && rule.IncludePaths.MatchString(f.Path) {
-			if _, ok := ignores[rule.Id]; !ok {
-				if rule.Fn(f.Path, idx, line) {
-					finding := Finding{Path: f.Path, LineNo: lineNo, LineIndex: idx, Line: line, Rule: rule, RuleId: rule.Id}
-					f.Findings = append(f.Findings, finding)
-				}
-			}
+		for _, match := range scan.matches(ruleIdx, f.Path, idx) {
+			finding := Finding{Path: f.Path, LineNo: lineNo, LineIndex: idx, Line: line, Rule: rule, RuleId: rule.Id, Range: match.Range, Fix: match.Fix}
+			addFinding(f, withMatchDetails(finding, match))
 		}
 	}
 	return nil
 }
 
 func LoadConfigFile(content string) (ConfigFile, error) {
+	return LoadConfigFileWithSource(content, "")
+}
+
+// LoadConfigFileWithSource parses a config and its includes, using source to describe where
+// problems were found. Every problem is collected and returned together as ConfigErrors
+// alongside the rules that did load.
+func LoadConfigFileWithSource(content string, source string) (ConfigFile, error) {
+	config, errs := loadConfig(content, source)
+	config.literals = buildLiteralMatcher(config)
+	if len(errs) > 0 {
+		return config, errs
+	}
+	return config, nil
+}
+
+func loadConfig(content string, source string) (ConfigFile, ConfigErrors) {
 	var rawConfig RawConfig
 	var config ConfigFile
+	var errs ConfigErrors
 	err := yaml.Unmarshal([]byte(content), &rawConfig)
 	if err != nil {
-		logz.Errorf("Error unmarshalling YAML: %v", err)
-		return ConfigFile{}, err
+		errs = append(errs, yamlConfigErrors(err, source)...)
+		// Type errors still decode the remaining fields, anything else leaves nothing to check
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return ConfigFile{}, errs
+		}
 	}
-
-	if !strings.HasPrefix(rawConfig.Version, "v") {
-		logz.Errorf("Error: config file version must start with a 'v' but was %s\n", rawConfig.Version)
-		panic("Invalid version due to semver incompatibility")
+	positions := newConfigPositions(content)
+	if u, err := url.Parse(source); source != "" && err == nil && (u.Scheme == "" || u.Scheme == "file") {
+		if absPath, err := filepath.Abs(u.Path); err == nil {
+			config.Sources = append(config.Sources, absPath)
+		}
 	}
 
-	if !semver.IsValid(rawConfig.Version) {
-		logz.Errorf("Error: Config version %s is newer than binary version %s\n", rawConfig.Version, viper.GetString("binary_version"))
-		logz.Errorln(semver.IsValid(rawConfig.Version))
-		panic("Invalid version due to semver incompatibility")
+	versionErr := func(format string, args ...any) {
+		line, col := positions.key("version")
+		errs = append(errs, &ConfigError{Source: source, Line: line, Column: col, Err: fmt.Errorf(format, args...)})
+	}
+	if !strings.HasPrefix(rawConfig.Version, "v") {
+		versionErr("config file version must start with a 'v' but was %q", rawConfig.Version)
+	} else if !semver.IsValid(rawConfig.Version) {
+		versionErr("config file version %q is not valid semver", rawConfig.Version)
 	}
 
 	// If version file is too new for binary version
@@ -125,51 +307,104 @@ func LoadConfigFile(content string) (ConfigFile, error) {
 	}
 
 	config.Version = rawConfig.Version
-	for _, rule := range rawConfig.Rules {
+	config.RequireIgnoreReason = rawConfig.RequireIgnoreReason
+	for idx, rule := range rawConfig.Rules {
+		ruleErr := func(err error, keys ...string) {
+			line, col := positions.rule(idx, keys...)
+			errs = append(errs, &ConfigError{RuleId: rule.Id, Source: source, Line: line, Column: col, Err: err})
+		}
+
+		valid := true
+		if rule.Id == "" {
+			ruleErr(errors.New("rule is missing an id"))
+			valid = false
+		}
+		severity, err := ParseSeverityLevel(rule.Severity)
+		if err != nil {
+			ruleErr(err, "severity")
+			valid = false
+		}
+		fn, err := BuildFn(rule.Fn)
+		if err != nil {
+			ruleErr(err, "fn", fnErrorField(err))
+			valid = false
+		}
+		if !valid {
+			continue
+		}
+
+		line, col := positions.rule(idx)
+		literal, _ := literalPattern(rule.Fn)
 		config.Rules = append(config.Rules, Rule{
 			Id:             rule.Id,
 			Description:    rule.Description,
 			Recommendation: rule.Recommendation,
-			Severity:       severityLevelFromString(rule.Severity),
+			Severity:       severity,
 			Link:           rule.Link,
 			IncludePaths:   rule.IncludePaths,
 			ExcludePaths:   rule.ExcludePaths,
-			Fn:             BuildFn(rule.Fn),
+			Fn:             fn,
 			Scope:          rule.Fn.Scope,
+			Origin:         RuleOrigin{Source: source, Line: line, Column: col},
+			source:         rule.Fn,
+			literal:        literal,
 		})
 	}
 
-	for _, include := range rawConfig.Includes {
+	for idx, include := range rawConfig.Includes {
+		includeErr := func(err error, key string) {
+			line, col := positions.include(idx, key)
+			errs = append(errs, &ConfigError{Source: source, Line: line, Column: col, Err: err})
+		}
+
 		u, err := url.Parse(include.Path)
 		if err != nil {
-			panic(fmt.Sprintf("Error parsing include path %s", include.Path))
+			includeErr(fmt.Errorf("error parsing include path %s: %v", include.Path, err), "path")
+			continue
 		}
 
 		var content string
 		switch u.Scheme {
-		case "":
-			content = getFileContentFromURI(u)
-		case "file":
-			content = getFileContentFromURI(u)
+		case "", "file":
+			content, err = getFileContentFromURI(u)
 		case "http", "https":
-			content = getURLContent(u.String())
+			content, err = getURLContent(u.String())
+		default:
+			err = fmt.Errorf("unsupported include scheme %q", u.Scheme)
+		}
+		if err != nil {
+			includeErr(err, "path")
+			continue
 		}
 
 		// TODO: add tests
 		if include.Hash != "" {
 			if !CheckContentHash(include.Hash, content) {
-				panic(fmt.Sprintf("WARNING: content does not match expected hash.\n Actual %s!= Expected %s\n", include.Hash, "sha256:"+SHA256(content)))
+				includeErr(fmt.Errorf("content of %s does not match expected hash %s, actual sha256:%s", include.Path, include.Hash, SHA256(content)), "hash")
+				continue
 			}
 		}
 
-		cfg, err := LoadConfigFile(content)
-		if err != nil {
-			panic(err)
+		cfg, includeErrs := loadConfig(content, include.Path)
+		for _, e := range includeErrs {
+			if e.IncludedFrom == "" {
+				e.IncludedFrom = source
+			}
+			errs = append(errs, e)
 		}
 		config.Rules = append(config.Rules, cfg.Rules...)
+		config.Sources = append(config.Sources, cfg.Sources...)
+		// Shared configs can enforce reasons on the configs that include them
+		config.RequireIgnoreReason = config.RequireIgnoreReason || cfg.RequireIgnoreReason
+		config.Overrides = append(config.Overrides, cfg.Overrides...)
 	}
 
-	return config, nil
+	// Overrides are resolved last since they may refer to the rules of includes
+	overrides, overrideErrs := buildOverrides(rawConfig.Overrides, config.Rules, source, positions)
+	errs = append(errs, overrideErrs...)
+	config.Overrides = append(config.Overrides, overrides...)
+
+	return config, errs
 }
 
 func CheckContentHash(expectedHash, content string) bool {
@@ -195,27 +430,37 @@ func CheckContentHash(expectedHash, content string) bool {
 
 func ValidateConfigFile(config ConfigFile) error {
 	// Ensure uniqueness of rule ids
-	ids := make(map[string]bool)
+	var errs ConfigErrors
+	ids := make(map[string]Rule)
 	for _, rule := range config.Rules {
-		if _, ok := ids[rule.Id]; !ok {
-			ids[rule.Id] = true
+		if first, ok := ids[rule.Id]; !ok {
+			ids[rule.Id] = rule
 		} else {
-			panic(fmt.Sprintf("Received duplicate id %s", rule.Id))
+			errs = append(errs, &ConfigError{
+				RuleId: rule.Id,
+				Source: rule.Origin.Source,
+				Line:   rule.Origin.Line,
+				Column: rule.Origin.Column,
+				Err:    fmt.Errorf("duplicate id, first declared at %s", first.Origin),
+			})
 		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
-func getFileContentFromURI(u *url.URL) string {
+func getFileContentFromURI(u *url.URL) (string, error) {
 	absPath, err := filepath.Abs(u.Path)
 	if err != nil {
-		panic(fmt.Sprintf("Error getting absolute path %s: %v", u.Path, err))
+		return "", fmt.Errorf("error getting absolute path %s: %v", u.Path, err)
 	}
 	fileContent, err := os.ReadFile(absPath)
 	if err != nil {
-		panic(fmt.Sprintf("Error reading file %s: %v", u.Path, err))
+		return "", fmt.Errorf("error reading file %s: %v", u.Path, err)
 	}
-	return string(fileContent)
+	return string(fileContent), nil
 }
 
 func SHA256(content string) string {
@@ -228,51 +473,23 @@ func SHA256(content string) string {
 	return fmt.Sprintf("%x", bs)
 }
 
-func getURLContent(link string) string {
+func getURLContent(link string) (string, error) {
 	res, err := http.Get(link)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 	content, err := io.ReadAll(res.Body)
 	res.Body.Close()
 	if err != nil {
-		log.Fatal(err)
-	}
-	return string(content)
-}
-
-func severityLevelFromString(s string) SeverityLevel {
-	switch s {
-	case "low":
-		return lowSeverity
-	case "medium":
-		return mediumSeverity
-	case "high":
-		return highSeverity
-	default:
-		panic("unknown severity level")
+		return "", err
 	}
-}
-
-func buildLineFnBuiltin(f RawFn) RuleFunc {
-	switch f.Name {
-	case "contains":
-		matchOn := f.Args[0].(string)
-		return func(_path string, _idx int, line string) bool {
-			return strings.Contains(line, matchOn)
-		}
-	case "regexp":
-		matchOnRaw := f.Args[0].(string)
-		matchOn := regexp.MustCompile(matchOnRaw)
-		return func(_path string, _idx int, line string) bool {
-			return matchOn.MatchString(line)
-		}
-	default:
-		panic(fmt.Sprintf("unknown builtin %s", f.Name))
+	if res.StatusCode >= 400 {
+		return "", fmt.Errorf("error fetching %s: %s", link, res.Status)
 	}
+	return string(content), nil
 }
 
-func BuildFn(f RawFn) RuleFunc {
+func BuildFn(f RawFn) (RuleFunc, error) {
 	switch f.Scope {
 	case lineScope:
 		return BuildLineFn(f)
@@ -281,24 +498,24 @@ func BuildFn(f RawFn) RuleFunc {
 	case pathScope:
 		return BuildPathScopeFn(f)
 	default:
-		panic(fmt.Sprintf("unknown scope %s", f.Scope))
+		return nil, fnErrorf("scope", "unknown scope %q", f.Scope)
 	}
 }
 
-func BuildLineFn(f RawFn) RuleFunc {
+func BuildLineFn(f RawFn) (RuleFunc, error) {
 	switch f.Type {
 	case "builtin":
-		return buildLineFnBuiltin(f)
+		return buildBuiltin(f)
 	case "js":
 		return buildJsFn(f)
 	case "wasm":
 		return buildWasmFn(f)
 	default:
-		panic(fmt.Sprintf("unknown type %s", f.Type))
+		return nil, fnErrorf("type", "unknown type %q", f.Type)
 	}
 }
 
-func BuildFileScopeFn(f RawFn) RuleFunc {
+func BuildFileScopeFn(f RawFn) (RuleFunc, error) {
 	switch f.Type {
 	case "builtin":
 		return BuildFileFnBuiltin(f)
@@ -307,44 +524,19 @@ func BuildFileScopeFn(f RawFn) RuleFunc {
 	case "wasm":
 		return buildWasmFn(f)
 	default:
-		panic(fmt.Sprintf("unknown type %s", f.Type))
+		return nil, fnErrorf("type", "unknown type %q", f.Type)
 	}
 }
 
-func BuildFileFnBuiltin(f RawFn) RuleFunc {
-	switch f.Name {
-	case "contains":
-		matchOn := f.Args[0].(string)
-		return func(_path string, _idx int, file string) bool {
-			return strings.Contains(file, matchOn)
-		}
-	case "regexp":
-		matchOnRaw := f.Args[0].(string)
-		matchOn := regexp.MustCompile(matchOnRaw)
-		return func(_path string, _idx int, file string) bool {
-			return matchOn.MatchString(file)
-		}
-	default:
-		panic(fmt.Sprintf("unknown builtin %s", f.Name))
-	}
+func BuildFileFnBuiltin(f RawFn) (RuleFunc, error) {
+	return buildBuiltin(f)
 }
 
-func BuildFileFnJs(f RawFn) RuleFunc {
-	vm := goja.New()
-	_, err := vm.RunString(f.Body)
-	if err != nil {
-		panic(err)
-	}
-	var fn func(path string, idx int, file string) bool
-	err = vm.ExportTo(vm.Get(f.Name), &fn)
-	if err != nil {
-		panic(err)
-	}
-
-	return fn
+func BuildFileFnJs(f RawFn) (RuleFunc, error) {
+	return buildJsFn(f)
 }
 
-func BuildPathScopeFn(f RawFn) RuleFunc {
+func BuildPathScopeFn(f RawFn) (RuleFunc, error) {
 	switch f.Type {
 	case "builtin":
 		return BuildPathFnBuiltin(f)
@@ -353,60 +545,78 @@ func BuildPathScopeFn(f RawFn) RuleFunc {
 	case "wasm":
 		return buildWasmFn(f)
 	default:
-		panic(fmt.Sprintf("unknown type %s", f.Type))
+		return nil, fnErrorf("type", "unknown type %q", f.Type)
 	}
 }
 
-func BuildPathFnBuiltin(f RawFn) RuleFunc {
-	switch f.Name {
-	case "contains":
-		matchOn := f.Args[0].(string)
-		return func(path string, _idx int, _file string) bool {
-			return strings.Contains(path, matchOn)
-		}
-	case "regexp":
-		matchOnRaw := f.Args[0].(string)
-		matchOn := regexp.MustCompile(matchOnRaw)
-		return func(path string, _idx int, _file string) bool {
-			return matchOn.MatchString(path)
-		}
-	default:
-		panic(fmt.Sprintf("unknown builtin %s", f.Name))
-	}
+func BuildPathFnBuiltin(f RawFn) (RuleFunc, error) {
+	return buildBuiltin(f)
+}
 
+func BuildPathFnJs(f RawFn) (RuleFunc, error) {
+	return buildJsFn(f)
 }
 
-func BuildPathFnJs(f RawFn) RuleFunc {
+// buildJsFn evaluates the body in a fresh goja VM and exports the function named by f.Name.
+// Line, file and path scoped js rules share the same (path, idx, content) signature.
+func buildJsFn(f RawFn) (RuleFunc, error) {
 	vm := goja.New()
 	_, err := vm.RunString(f.Body)
 	if err != nil {
-		panic(err)
+		return nil, fnErrorf("body", "error evaluating js body: %v", err)
+	}
+	value := vm.Get(f.Name)
+	if value == nil || goja.IsUndefined(value) {
+		return nil, fnErrorf("name", "js function %s is not defined in body", f.Name)
 	}
-	var fn func(path string, idx int, file string) bool
-	err = vm.ExportTo(vm.Get(f.Name), &fn)
+	var fn func(path string, idx int, line string) goja.Value
+	err = vm.ExportTo(value, &fn)
 	if err != nil {
-		panic(err)
+		return nil, fnErrorf("name", "error exporting js function %s: %v", f.Name, err)
 	}
 
-	return fn
+	return func(path string, idx int, line string) []Match {
+		result, err := jsRuleResult(fn(path, idx, line))
+		if err != nil {
+			logz.Errorf("ERROR: js function %s returned an invalid result: %v\n", f.Name, err)
+			return nil
+		}
+		return result.matches()
+	}, nil
 }
 
-func buildJsFn(f RawFn) RuleFunc {
-	vm := goja.New()
-	_, err := vm.RunString(f.Body)
-	if err != nil {
-		panic(err)
+// jsRuleResult accepts an object shaped like RuleFuncResult or an array of match objects.
+// Any other value is truthy or falsy as it is in js, so rules returning line.match(/re/) or
+// a number keep working.
+func jsRuleResult(value goja.Value) (RuleFuncResult, error) {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return RuleFuncResult{}, nil
+	}
+	exported := value.Export()
+	switch v := exported.(type) {
+	case map[string]interface{}:
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); !ok {
+				return RuleFuncResult{Value: value.ToBoolean()}, nil
+			}
+		}
+		// An array of objects is shorthand for {matches: [...]}
+		exported = map[string]interface{}{"matches": v}
+	default:
+		return RuleFuncResult{Value: value.ToBoolean()}, nil
 	}
-	var fn func(path string, idx int, line string) bool
-	err = vm.ExportTo(vm.Get(f.Name), &fn)
+	// Round trip through JSON so js and wasm results share one decoder
+	raw, err := json.Marshal(exported)
 	if err != nil {
-		panic(err)
+		return RuleFuncResult{}, err
 	}
-
-	return fn
+	var result RuleFuncResult
+	err = json.Unmarshal(raw, &result)
+	return result, err
 }
 
-func buildWasmFn(f RawFn) RuleFunc {
+func buildWasmFn(f RawFn) (RuleFunc, error) {
 	hash, err := f.GetMetadataHash()
 	if err != nil {
 		logz.Warnf("Warning: cannot find metadata hash for %s\n", f.Body)
@@ -425,7 +635,7 @@ func buildWasmFn(f RawFn) RuleFunc {
 		}
 	}
 	if err != nil {
-		panic(err)
+		return nil, fnErrorf("body", "error loading wasm module %s: %v", f.Body, err)
 	}
 
 	ok := f.CheckWASMHash(content, hash)
@@ -451,11 +661,10 @@ func buildWasmFn(f RawFn) RuleFunc {
 
 	plugin, err := extism.NewPlugin(ctx, manifest, config, []extism.HostFunction{})
 	if err != nil {
-		logz.Errorf("Failed to initialize plugin: %v\n", err)
-		os.Exit(1)
+		return nil, fnErrorf("body", "failed to initialize wasm plugin %s: %v", f.Body, err)
 	}
 
-	return func(path string, idx int, line string) bool {
+	return func(path string, idx int, line string) []Match {
 		args := RuleFuncArgs{path, idx, line}
 		b, err := json.Marshal(&args)
 		if err != nil {
@@ -470,14 +679,141 @@ func buildWasmFn(f RawFn) RuleFunc {
 		var result RuleFuncResult
 		json.Unmarshal(bytes, &result)
 
-		return result.Value
-	}
+		return result.matches()
+	}, nil
 }
 
 type RuleFuncArgs [3]interface{}
 
+// RuleFuncResult is the result returned by js and wasm rules, e.g. `{"value": true, "fix": {...}}`
+// or `{"matches": [{"line": 3, "message": "..."}]}` to report one finding per match
 type RuleFuncResult struct {
-	Value bool
+	Value   bool
+	Fix     *Edit         `json:"fix,omitempty"`
+	Matches []MatchResult `json:"matches,omitempty"`
+}
+
+// MatchResult is a single match within a RuleFuncResult. Line is only used by file scoped
+// rules, Message and Severity override the rule's Recommendation and Severity.
+type MatchResult struct {
+	Start    *int   `json:"start,omitempty"`
+	End      *int   `json:"end,omitempty"`
+	Fix      *Edit  `json:"fix,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Severity string `json:"severity,omitempty"`
+}
+
+func (m MatchResult) match() Match {
+	match := Match{Fix: m.Fix, Line: m.Line, Column: m.Column, Message: m.Message}
+	if m.Severity != "" {
+		severity, err := ParseSeverityLevel(m.Severity)
+		if err != nil {
+			logz.Warnf("WARNING: ignoring severity returned by rule: %v\n", err)
+		}
+		match.Severity = severity
+	}
+	if m.Start != nil {
+		end := *m.Start
+		if m.End != nil {
+			end = *m.End
+		}
+		match.Range = &Range{Start: *m.Start, End: end}
+	}
+	return match
+}
+
+func (r RuleFuncResult) matches() []Match {
+	if len(r.Matches) > 0 {
+		matches := make([]Match, len(r.Matches))
+		for idx, m := range r.Matches {
+			matches[idx] = m.match()
+		}
+		return matches
+	}
+	if !r.Value {
+		return nil
+	}
+	return []Match{{Fix: r.Fix}}
+}
+
+// withMatchDetails applies the message, severity and column reported with a match, falling
+// back to the rule's Recommendation and Severity
+func withMatchDetails(finding Finding, match Match) Finding {
+	finding.Message = finding.Rule.Recommendation
+	if match.Message != "" {
+		finding.Message = match.Message
+	}
+	finding.Severity = finding.Rule.Severity
+	if match.Severity != unknownSeverity {
+		finding.Severity = match.Severity
+	}
+	if match.Column > 0 && finding.LineNo > 0 {
+		finding.StartColumn = match.Column
+	}
+	if match.EndLine > 0 && finding.LineNo > 0 {
+		finding.EndColumn = match.EndColumn
+		if match.EndLine != finding.LineNo {
+			finding.EndLineNo = match.EndLine
+		}
+	}
+	return finding
+}
+
+// resolveRange converts the range returned by a rule into byte offsets of the whole file and,
+// for line scoped rules, into character columns. Path scoped ranges don't refer to content.
+func resolveRange(finding *Finding, offsets []int, contentLen int) {
+	r := finding.Range
+	finding.Range = nil
+	if r == nil || finding.Rule.Scope == pathScope {
+		return
+	}
+	if finding.Rule.Scope == lineScope {
+		if r.Start < 0 || r.End < r.Start || r.End > len(finding.Line) {
+			return
+		}
+		finding.Range = &Range{Start: offsets[finding.LineIndex] + r.Start, End: offsets[finding.LineIndex] + r.End}
+		finding.StartColumn = utf8.RuneCountInString(finding.Line[:r.Start]) + 1
+		finding.EndColumn = utf8.RuneCountInString(finding.Line[:r.End]) + 1
+		return
+	}
+	if r.Start < 0 || r.End < r.Start || r.End > contentLen {
+		return
+	}
+	finding.Range = &Range{Start: r.Start, End: r.End}
+}
+
+// resolveFix converts an edit returned by a rule into byte offsets of the whole file.
+// Path scoped rules can't edit content so their fixes are dropped.
+func resolveFix(finding Finding, lines []string, offsets []int) *Edit {
+	fix := finding.Fix
+	if fix == nil || finding.Rule.Scope == pathScope {
+		return nil
+	}
+	if fix.StartLine > 0 {
+		endLine := fix.EndLine
+		if endLine < fix.StartLine {
+			endLine = fix.StartLine
+		}
+		if endLine > len(lines) {
+			return nil
+		}
+		return &Edit{
+			Start:       offsets[fix.StartLine-1],
+			End:         offsets[endLine-1] + len(lines[endLine-1]),
+			Replacement: fix.Replacement,
+		}
+	}
+
+	base, limit := 0, offsets[len(offsets)-1]+len(lines[len(lines)-1])
+	if finding.Rule.Scope == lineScope {
+		base, limit = offsets[finding.LineIndex], len(finding.Line)
+	}
+	if fix.Start < 0 || fix.End < fix.Start || fix.End > limit {
+		return nil
+	}
+	return &Edit{Start: base + fix.Start, End: base + fix.End, Replacement: fix.Replacement}
 }
 
 func ProcessFile(content string, path string, cfg ConfigFile) (FileReport, error) {
@@ -487,40 +823,67 @@ func ProcessFile(content string, path string, cfg ConfigFile) (FileReport, error
 		Findings: []Finding{},
 	}
 
+	set := newRuleSet(cfg.rulesFor(path), cfg.literals, path)
 	lines := strings.Split(content, "\n")
+	extractIgnores(lines, &f)
+	offsets := make([]int, len(lines))
 	for idx, line := range lines {
-		err := processLine(line, idx, &f)
+		if idx > 0 {
+			offsets[idx] = offsets[idx-1] + len(lines[idx-1]) + 1
+		}
+		err := processLine(line, idx, &f, set)
 		if err != nil {
 			logz.Errorf("ERROR: %s\n", err)
 			return FileReport{}, err
 		}
 	}
 
-	ignores := getIgnoresForLine(&f, 0)
-	for _, c := range f.Rules {
+	fileScan := ruleScan{set: set, text: content}
+	for ruleIdx, c := range set.rules {
 		if c.Scope == fileScope || c.Scope == pathScope {
 			lineIdx := -1
 			lineNo := 0
-			if c.ExcludePaths != nil && c.ExcludePaths.MatchString(f.Path) {
-				continue
-			}
-			// TODO: currently does not support checking for file level ignores or path ignores
-			if c.IncludePaths != nil && c.IncludePaths.MatchString(f.Path) {
-				if _, ok := ignores[c.Id]; !ok {
-					if c.Fn(f.Path, lineIdx, content) {
-						f.Findings = append(f.Findings, Finding{
-							Path:      f.Path,
-							Line:      content,
-							LineIndex: lineIdx,
-							LineNo:    lineNo,
-							Rule:      c,
-							RuleId:    c.Id,
-						})
-					}
+			for _, match := range fileScan.matches(ruleIdx, f.Path, lineIdx) {
+				finding := Finding{
+					Path:      f.Path,
+					Line:      content,
+					LineIndex: lineIdx,
+					LineNo:    lineNo,
+					Rule:      c,
+					RuleId:    c.Id,
+					Range:     match.Range,
+					Fix:       match.Fix,
+				}
+				// Matches that only have a range, like those of contains and regexp, point at the
+				// line and column the range starts at
+				if c.Scope == fileScope && match.Line == 0 && match.Range != nil &&
+					match.Range.Start >= 0 && match.Range.Start <= match.Range.End && match.Range.End <= len(content) {
+					match.Line, match.Column = lineColumnAt(content, offsets, match.Range.Start)
+					match.EndLine, match.EndColumn = lineColumnAt(content, offsets, match.Range.End)
+				}
+				// File scoped rules may point at a specific line
+				if c.Scope == fileScope && match.Line > 0 && match.Line <= len(lines) {
+					finding.LineNo = match.Line
+					finding.LineIndex = match.Line - 1
+					finding.Line = lines[match.Line-1]
 				}
+				addFinding(&f, withMatchDetails(finding, match))
 			}
 		}
 	}
 
+	if cfg.RequireIgnoreReason {
+		f.Findings = append(f.Findings, missingReasonFindings(&f)...)
+	}
+
+	for idx := range f.Findings {
+		f.Findings[idx].Fix = resolveFix(f.Findings[idx], lines, offsets)
+		resolveRange(&f.Findings[idx], offsets, len(content))
+	}
+	for idx := range f.Suppressed {
+		f.Suppressed[idx].Fix = nil
+		resolveRange(&f.Suppressed[idx], offsets, len(content))
+	}
+
 	return f, nil
 }
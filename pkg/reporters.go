@@ -0,0 +1,462 @@
+package polylint
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/viper"
+)
+
+// Reporter renders the results of a run to an output stream
+type Reporter interface {
+	Report(w io.Writer, reports []FileReport) error
+}
+
+const (
+	TableFormat = "table"
+	JSONFormat  = "json"
+	SARIFFormat = "sarif"
+	JUnitFormat = "junit"
+)
+
+var reporters = map[string]Reporter{
+	TableFormat: TableReporter{},
+	JSONFormat:  JSONReporter{},
+	SARIFFormat: SARIFReporter{},
+	JUnitFormat: JUnitReporter{},
+}
+
+// ReporterFormats lists the names accepted by NewReporter
+func ReporterFormats() []string {
+	formats := make([]string, 0, len(reporters))
+	for name := range reporters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func NewReporter(format string) (Reporter, error) {
+	r, ok := reporters[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q, expected one of %v", format, ReporterFormats())
+	}
+	return r, nil
+}
+
+// SummaryReporter renders the human readable count of violations per file
+type SummaryReporter struct{}
+
+func (SummaryReporter) Report(w io.Writer, reports []FileReport) error {
+	summary := table.NewWriter()
+	summary.SetOutputMirror(w)
+	summary.AppendHeader(table.Row{"File", "Violations"})
+	summary.SortBy([]table.SortBy{
+		{Name: "Violations", Mode: table.Dsc},
+	})
+	for _, result := range reports {
+		if len(result.Findings) > 0 {
+			summary.AppendRow([]interface{}{result.Path, len(result.Findings)})
+		}
+	}
+	summary.Render()
+	return nil
+}
+
+// WarningsReporter renders problems with the polylint directives of each file
+type WarningsReporter struct{}
+
+func (WarningsReporter) Report(w io.Writer, reports []FileReport) error {
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.SetTitle("Directive warnings")
+	t.AppendHeader(table.Row{"File", "Line", "Warning"})
+	for _, result := range reports {
+		for _, warning := range result.Warnings {
+			t.AppendRow([]interface{}{result.Path, warning.LineNo, warning.Message})
+		}
+	}
+	if t.Length() > 0 {
+		t.Render()
+	}
+	return nil
+}
+
+// TableReporter renders one row per finding
+type TableReporter struct{}
+
+func (TableReporter) Report(w io.Writer, reports []FileReport) error {
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.AppendHeader(table.Row{"File", "#", "Scope", "Rule Id", "Recommendation", "Link"})
+	for _, result := range reports {
+		for idx, finding := range result.Findings {
+			scope := string(finding.Rule.Scope)
+			if finding.LineNo > 0 && finding.StartColumn > 0 {
+				scope = fmt.Sprintf("%s %3d:%d", finding.Rule.Scope, finding.LineNo, finding.StartColumn)
+			} else if finding.LineNo > 0 {
+				scope = fmt.Sprintf("%s %3d", finding.Rule.Scope, finding.LineNo)
+			}
+			t.AppendRow([]interface{}{
+				result.Path, idx + 1, scope, finding.RuleId, finding.Message, finding.Rule.Link,
+			})
+		}
+	}
+	t.Render()
+	return nil
+}
+
+type jsonFinding struct {
+	Path           string `json:"path"`
+	LineNo         int    `json:"line_no"`
+	StartColumn    int    `json:"start_column,omitempty"`
+	EndColumn      int    `json:"end_column,omitempty"`
+	EndLineNo      int    `json:"end_line_no,omitempty"`
+	Range          *Range `json:"range,omitempty"`
+	Scope          Scope  `json:"scope"`
+	RuleId         string `json:"rule_id"`
+	Severity       string `json:"severity"`
+	Description    string `json:"description"`
+	Recommendation string `json:"recommendation"`
+	Message        string `json:"message"`
+	Link           string `json:"link"`
+	Line           string `json:"line,omitempty"`
+	// SuppressedBy is only set on suppressed findings
+	SuppressedBy *jsonSuppression `json:"suppressed_by,omitempty"`
+}
+
+type jsonSuppression struct {
+	RuleId       string `json:"rule_id"`
+	Scope        Scope  `json:"scope"`
+	SourceLineNo int    `json:"source_line_no"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+type jsonWarning struct {
+	Path    string `json:"path"`
+	LineNo  int    `json:"line_no"`
+	Message string `json:"message"`
+}
+
+type jsonReport struct {
+	Findings   []jsonFinding `json:"findings"`
+	Suppressed []jsonFinding `json:"suppressed,omitempty"`
+	Warnings   []jsonWarning `json:"warnings,omitempty"`
+}
+
+func newJSONFinding(finding Finding) jsonFinding {
+	jf := jsonFinding{
+		Path:           finding.Path,
+		LineNo:         finding.LineNo,
+		StartColumn:    finding.StartColumn,
+		EndColumn:      finding.EndColumn,
+		EndLineNo:      finding.EndLineNo,
+		Range:          finding.Range,
+		Scope:          finding.Rule.Scope,
+		RuleId:         finding.RuleId,
+		Severity:       finding.Severity.String(),
+		Description:    finding.Rule.Description,
+		Recommendation: finding.Rule.Recommendation,
+		Message:        finding.Message,
+		Link:           finding.Rule.Link,
+	}
+	// File scoped findings without a line number carry the whole file as their line
+	if finding.LineNo > 0 {
+		jf.Line = finding.Line
+	}
+	if s := finding.SuppressedBy; s != nil {
+		jf.SuppressedBy = &jsonSuppression{RuleId: s.Id, Scope: s.Scope, SourceLineNo: s.SourceLineNo, Reason: s.Reason}
+	}
+	return jf
+}
+
+// JSONReporter renders all findings as a single JSON document
+type JSONReporter struct{}
+
+func (JSONReporter) Report(w io.Writer, reports []FileReport) error {
+	out := jsonReport{Findings: []jsonFinding{}}
+	for _, result := range reports {
+		for _, finding := range result.Findings {
+			out.Findings = append(out.Findings, newJSONFinding(finding))
+		}
+		for _, finding := range result.Suppressed {
+			out.Suppressed = append(out.Suppressed, newJSONFinding(finding))
+		}
+		for _, warning := range result.Warnings {
+			out.Warnings = append(out.Warnings, jsonWarning{Path: result.Path, LineNo: warning.LineNo, Message: warning.Message})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations,omitempty"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications"`
+}
+
+// sarifNotification reports a problem with the run itself rather than with the linted code
+type sarifNotification struct {
+	Level     string          `json:"level"`
+	Message   sarifText       `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifRuleConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifRule struct {
+	Id                   string          `json:"id"`
+	ShortDescription     sarifText       `json:"shortDescription"`
+	Help                 *sarifText      `json:"help,omitempty"`
+	HelpUri              string          `json:"helpUri,omitempty"`
+	DefaultConfiguration sarifRuleConfig `json:"defaultConfiguration"`
+}
+
+type sarifResult struct {
+	RuleId       string             `json:"ruleId"`
+	RuleIndex    int                `json:"ruleIndex"`
+	Level        string             `json:"level"`
+	Message      sarifText          `json:"message"`
+	Locations    []sarifLocation    `json:"locations"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+}
+
+// sarifSuppression marks a result silenced by a polylint directive in the linted file
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int  `json:"startLine,omitempty"`
+	StartColumn int  `json:"startColumn,omitempty"`
+	EndLine     int  `json:"endLine,omitempty"`
+	EndColumn   int  `json:"endColumn,omitempty"`
+	ByteOffset  *int `json:"byteOffset,omitempty"`
+	ByteLength  *int `json:"byteLength,omitempty"`
+}
+
+// sarifRegionFor locates a finding by line and column when known, falling back to the
+// byte range for file scoped findings
+func sarifRegionFor(finding Finding) *sarifRegion {
+	if finding.LineNo > 0 {
+		return &sarifRegion{StartLine: finding.LineNo, StartColumn: finding.StartColumn, EndLine: finding.EndLineNo, EndColumn: finding.EndColumn}
+	}
+	if finding.Range != nil {
+		length := finding.Range.End - finding.Range.Start
+		return &sarifRegion{ByteOffset: &finding.Range.Start, ByteLength: &length}
+	}
+	return nil
+}
+
+func sarifLevel(s SeverityLevel) string {
+	switch s {
+	case highSeverity:
+		return "error"
+	case mediumSeverity:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// SARIFReporter renders findings as a SARIF 2.1.0 log for code scanning tools
+type SARIFReporter struct{}
+
+func (SARIFReporter) Report(w io.Writer, reports []FileReport) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "polylint",
+			Version:        viper.GetString("binary_version"),
+			InformationUri: "https://github.com/zph/polylint",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	ruleIndexes := make(map[string]int)
+	addRule := func(rule Rule) int {
+		if idx, ok := ruleIndexes[rule.Id]; ok {
+			return idx
+		}
+		sr := sarifRule{
+			Id:                   rule.Id,
+			ShortDescription:     sarifText{Text: rule.Description},
+			HelpUri:              rule.Link,
+			DefaultConfiguration: sarifRuleConfig{Level: sarifLevel(rule.Severity)},
+		}
+		if rule.Recommendation != "" {
+			sr.Help = &sarifText{Text: rule.Recommendation}
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sr)
+		ruleIndexes[rule.Id] = len(run.Tool.Driver.Rules) - 1
+		return ruleIndexes[rule.Id]
+	}
+
+	for _, result := range reports {
+		for _, rule := range result.Rules {
+			addRule(rule)
+		}
+		// Suppressed findings are reported too, marked so code scanning shows them as dismissed
+		findings := make([]Finding, 0, len(result.Findings)+len(result.Suppressed))
+		findings = append(append(findings, result.Findings...), result.Suppressed...)
+		for _, finding := range findings {
+			location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{Uri: finding.Path},
+			}}
+			location.PhysicalLocation.Region = sarifRegionFor(finding)
+			message := finding.Rule.Description
+			if finding.Message != "" {
+				message = fmt.Sprintf("%s: %s", message, finding.Message)
+			}
+			sr := sarifResult{
+				RuleId:    finding.RuleId,
+				RuleIndex: addRule(finding.Rule),
+				Level:     sarifLevel(finding.Severity),
+				Message:   sarifText{Text: message},
+				Locations: []sarifLocation{location},
+			}
+			if finding.SuppressedBy != nil {
+				sr.Suppressions = []sarifSuppression{{Kind: "inSource", Justification: finding.SuppressedBy.Reason}}
+			}
+			run.Results = append(run.Results, sr)
+		}
+		for _, warning := range result.Warnings {
+			if len(run.Invocations) == 0 {
+				run.Invocations = []sarifInvocation{{ExecutionSuccessful: true}}
+			}
+			run.Invocations[0].ToolExecutionNotifications = append(run.Invocations[0].ToolExecutionNotifications, sarifNotification{
+				Level:   "warning",
+				Message: sarifText{Text: warning.Message},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{Uri: result.Path},
+					Region:           &sarifRegion{StartLine: warning.LineNo},
+				}}},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}})
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnitReporter renders one test suite per file and one failing test case per finding
+type JUnitReporter struct{}
+
+func (JUnitReporter) Report(w io.Writer, reports []FileReport) error {
+	out := junitTestSuites{Name: "polylint"}
+	for _, result := range reports {
+		suite := junitTestSuite{Name: result.Path}
+		for _, finding := range result.Findings {
+			name := finding.RuleId
+			if finding.LineNo > 0 {
+				name = fmt.Sprintf("%s:%d", finding.RuleId, finding.LineNo)
+			}
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      name,
+				ClassName: result.Path,
+				Failure: &junitFailure{
+					Message: finding.Message,
+					Type:    finding.Severity.String(),
+					Text:    fmt.Sprintf("%s\n%s", finding.Rule.Description, finding.Rule.Link),
+				},
+			})
+		}
+		suite.Failures = len(suite.Cases)
+		if len(suite.Cases) == 0 {
+			suite.Cases = append(suite.Cases, junitTestCase{Name: "polylint", ClassName: result.Path})
+		}
+		suite.Tests = len(suite.Cases)
+		out.Tests += suite.Tests
+		out.Failures += suite.Failures
+		out.Suites = append(out.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
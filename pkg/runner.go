@@ -0,0 +1,171 @@
+package polylint
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ReadPathList reads a list of paths, one per line or NUL separated as produced by
+// `git diff -z` and `find -print0`. Empty entries are skipped.
+func ReadPathList(r io.Reader) ([]string, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sep := []byte("\n")
+	if bytes.IndexByte(content, 0) >= 0 {
+		sep = []byte{0}
+	}
+	var paths []string
+	for _, entry := range bytes.Split(content, sep) {
+		if path := string(bytes.TrimRight(entry, "\r")); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// Fork returns a copy of the config that is safe to use from another goroutine.
+// Builtin rules are stateless and shared, while js and wasm rules get their own
+// goja VM and extism plugin instance because neither runtime is thread safe.
+func (c ConfigFile) Fork() (ConfigFile, error) {
+	fork := c
+	fork.Rules = make([]Rule, len(c.Rules))
+	for idx, rule := range c.Rules {
+		fn, err := forkFn(rule.Id, rule.Fn, rule.source)
+		if err != nil {
+			return ConfigFile{}, err
+		}
+		rule.Fn = fn
+		fork.Rules[idx] = rule
+	}
+	// Overrides with args have functions of their own
+	fork.Overrides = make([]Override, len(c.Overrides))
+	for idx, override := range c.Overrides {
+		override.Rules = make(map[string]RuleOverride, len(c.Overrides[idx].Rules))
+		for id, ruleOverride := range c.Overrides[idx].Rules {
+			if ruleOverride.Fn != nil {
+				fn, err := forkFn(id, ruleOverride.Fn, ruleOverride.source)
+				if err != nil {
+					return ConfigFile{}, err
+				}
+				ruleOverride.Fn = fn
+			}
+			override.Rules[id] = ruleOverride
+		}
+		fork.Overrides[idx] = override
+	}
+	return fork, nil
+}
+
+// forkFn rebuilds js and wasm functions and shares the stateless builtins
+func forkFn(id string, fn RuleFunc, source RawFn) (RuleFunc, error) {
+	if FnType(source.Type) != jsType && FnType(source.Type) != wasmType {
+		return fn, nil
+	}
+	fn, err := BuildFn(source)
+	if err != nil {
+		return nil, fmt.Errorf("error forking rule %s: %v", id, err)
+	}
+	return fn, nil
+}
+
+type fileJob struct {
+	idx  int
+	path string
+}
+
+// ProcessPaths reads and lints each path using a pool of jobs workers. Reports are
+// returned in the same order as paths regardless of which worker finished first.
+func ProcessPaths(paths []string, cfg ConfigFile, jobs int) ([]FileReport, []error) {
+	return ProcessPathsWithCache(paths, cfg, jobs, nil)
+}
+
+// ProcessPathsWithCache is ProcessPaths returning cached reports for unchanged files. Workers
+// only fork their runtimes once they reach a file that isn't cached.
+func ProcessPathsWithCache(paths []string, cfg ConfigFile, jobs int, cache *ResultCache) ([]FileReport, []error) {
+	return processPaths(paths, cfg, jobs, cache, os.ReadFile)
+}
+
+// ProcessStagedPaths is ProcessPathsWithCache linting the content staged in git instead of the
+// working tree copy, so that the lines of the staged diff match the content that is linted
+func ProcessStagedPaths(paths []string, cfg ConfigFile, jobs int, cache *ResultCache) ([]FileReport, []error) {
+	return processPaths(paths, cfg, jobs, cache, GitStagedContent)
+}
+
+func processPaths(paths []string, cfg ConfigFile, jobs int, cache *ResultCache, read func(string) ([]byte, error)) ([]FileReport, []error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(paths) {
+		jobs = len(paths)
+	}
+
+	reports := make([]*FileReport, len(paths))
+	errs := make([]error, len(paths))
+
+	work := make(chan fileJob)
+	var wg sync.WaitGroup
+	// forkMu serializes building runtimes, which may download and cache wasm modules
+	var forkMu sync.Mutex
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// The first worker reuses the caller's runtimes, the rest get their own
+			var workerCfg *ConfigFile
+			if w == 0 {
+				workerCfg = &cfg
+			}
+			for job := range work {
+				content, err := read(job.path)
+				if err != nil {
+					errs[job.idx] = fmt.Errorf("error reading file %q: %v", job.path, err)
+					continue
+				}
+				if cached, ok := cache.Get(job.path, content); ok {
+					reports[job.idx] = &cached
+					continue
+				}
+				if workerCfg == nil {
+					forkMu.Lock()
+					fork, err := cfg.Fork()
+					forkMu.Unlock()
+					if err != nil {
+						errs[job.idx] = err
+						continue
+					}
+					workerCfg = &fork
+				}
+				result, err := ProcessFile(string(content), job.path, *workerCfg)
+				if err != nil {
+					errs[job.idx] = fmt.Errorf("error processing file %q: %v", job.path, err)
+					continue
+				}
+				cache.Put(job.path, content, result)
+				reports[job.idx] = &result
+			}
+		}(w)
+	}
+
+	for idx, path := range paths {
+		work <- fileJob{idx: idx, path: path}
+	}
+	close(work)
+	wg.Wait()
+
+	var results []FileReport
+	var nonNilErrors []error
+	for idx := range paths {
+		if errs[idx] != nil {
+			nonNilErrors = append(nonNilErrors, errs[idx])
+		}
+		if reports[idx] != nil {
+			results = append(results, *reports[idx])
+		}
+	}
+	return results, nonNilErrors
+}
@@ -21,6 +21,33 @@ const (
 	highSeverity
 )
 
+// ParseSeverityLevel converts the config representation of a severity into a SeverityLevel
+func ParseSeverityLevel(s string) (SeverityLevel, error) {
+	switch s {
+	case "low":
+		return lowSeverity, nil
+	case "medium":
+		return mediumSeverity, nil
+	case "high":
+		return highSeverity, nil
+	default:
+		return unknownSeverity, fmt.Errorf("unknown severity level %q, expected one of low, medium, high", s)
+	}
+}
+
+func (s SeverityLevel) String() string {
+	switch s {
+	case lowSeverity:
+		return "low"
+	case mediumSeverity:
+		return "medium"
+	case highSeverity:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
 const (
 	builtinType FnType = "builtin"
 	jsType      FnType = "js"
@@ -35,17 +62,65 @@ const (
 )
 
 type Ignore struct {
+	// Id is a rule id or a wildcard pattern such as * or no-*
+	Id           string
+	Scope        Scope
+	SourceLineNo int
+	// SourceLine is the text of the line the directive was declared on
+	SourceLine string
+	// LineNo through EndLineNo are the lines disabled by a line scoped ignore
+	LineNo    int
+	EndLineNo int
+	// Reason is the justification given after -- in the directive
+	Reason string
+	// Hits counts the findings this ignore suppressed
+	Hits int
+}
+
+// Matches reports whether the ignore applies to ruleId
+func (i Ignore) Matches(ruleId string) bool {
+	if i.Id == ruleId || i.Id == "*" {
+		return true
+	}
+	matched, err := path.Match(i.Id, ruleId)
+	return err == nil && matched
+}
+
+// Suppression records the ignore directive that silenced a finding
+type Suppression struct {
+	// Id is the rule id or wildcard pattern of the directive
 	Id           string
 	Scope        Scope
 	SourceLineNo int
-	LineNo       int
+	Reason       string
+}
+
+// Warning is a problem with the polylint directives of a file that doesn't stop it being linted
+type Warning struct {
+	LineNo  int
+	Message string
 }
 
 type FileReport struct {
-	Path     string
-	Ignores  []Ignore
-	Rules    []Rule
+	Path    string
+	Ignores []Ignore
+	// Rules aren't serializable, ResultCache reattaches them by id
+	Rules    []Rule `json:"-"`
 	Findings []Finding
+	// Suppressed are the findings silenced by an ignore directive, kept for auditing
+	Suppressed []Finding `json:",omitempty"`
+	Warnings   []Warning
+}
+
+// FindingsAtOrAbove returns the findings whose severity meets the threshold
+func (f FileReport) FindingsAtOrAbove(threshold SeverityLevel) []Finding {
+	var findings []Finding
+	for _, finding := range f.Findings {
+		if finding.Severity >= threshold {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
 }
 
 type Finding struct {
@@ -53,11 +128,65 @@ type Finding struct {
 	Line      string
 	LineIndex int
 	LineNo    int
-	Rule      Rule
+	Rule      Rule `json:"-"`
 	RuleId    string
+	// Message explains this finding, defaulting to the rule's Recommendation
+	Message string
+	// Severity of this finding, defaulting to the rule's Severity
+	Severity SeverityLevel
+	// Range is the matched text as byte offsets into the whole file, nil when the rule
+	// only reported that the line or file matched
+	Range *Range
+	// StartColumn and EndColumn are the 1-indexed character columns of the match on LineNo.
+	// EndColumn is exclusive and both are 0 when the column is unknown.
+	StartColumn int
+	EndColumn   int
+	// EndLineNo is the 1-indexed line EndColumn is on when the match spans lines, 0 otherwise
+	EndLineNo int
+	// Fix is the edit that resolves this finding, as byte offsets into the whole file
+	Fix *Edit
+	// SuppressedBy is set on the findings in FileReport.Suppressed
+	SuppressedBy *Suppression `json:",omitempty"`
+}
+
+// Range is a span of bytes where End is exclusive
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
-type RuleFunc func(string, int, string) bool
+// Edit replaces the bytes between Start and End with Replacement. Rules return offsets
+// relative to the text they were called with (the line or the file). When StartLine is
+// set, whole lines StartLine through EndLine (1-indexed, inclusive) are replaced instead.
+type Edit struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	StartLine   int    `json:"start_line,omitempty"`
+	EndLine     int    `json:"end_line,omitempty"`
+	Replacement string `json:"replacement"`
+}
+
+// Match is a single violation reported by a RuleFunc
+type Match struct {
+	// Range is the matched span relative to the text the rule was called with, nil when the
+	// rule only reports that the text matched
+	Range *Range
+	Fix   *Edit
+	// Line is the 1-indexed line of the match for file scoped rules, 0 when unknown
+	Line int
+	// Column is the 1-indexed column of the match, 0 when unknown
+	Column int
+	// EndLine and EndColumn are where a file scoped match spanning lines ends, with EndColumn
+	// exclusive, 0 when unknown
+	EndLine   int
+	EndColumn int
+	// Message and Severity override the rule's Recommendation and Severity when set
+	Message  string
+	Severity SeverityLevel
+}
+
+// RuleFunc is called with (path, line index, line or file content) and returns one Match per violation
+type RuleFunc func(string, int, string) []Match
 type Rule struct {
 	Fn             RuleFunc
 	Id             string
@@ -70,6 +199,28 @@ type Rule struct {
 	IncludePaths *regexp.Regexp
 	ExcludePaths *regexp.Regexp
 	Scope        Scope
+	// Origin is where the rule was declared
+	Origin RuleOrigin
+	// source is the raw function definition, kept so that Fork can rebuild stateful runtimes
+	source RawFn
+	// literal is the text of a builtin contains rule that is matched by ConfigFile.literals
+	// instead of calling Fn
+	literal string
+}
+
+// RuleOrigin records the config file and position a rule was declared at
+type RuleOrigin struct {
+	Source string
+	Line   int
+	Column int
+}
+
+func (o RuleOrigin) String() string {
+	source := o.Source
+	if source == "" {
+		source = "<config>"
+	}
+	return fmt.Sprintf("%s:%d:%d", source, o.Line, o.Column)
 }
 
 type Fn struct {
@@ -84,13 +235,55 @@ type RawFn struct {
 	Type  string
 	Scope Scope
 	Name  string
-	Args  []any
+	Args  RawArgs
 	Body  string
 
 	// sha256: sha256 hash in hex form
 	Metadata map[string]any
 }
 
+// RawArgs are the args of a fn, given as a positional list or as a mapping of names to values
+type RawArgs struct {
+	Positional []any          `json:",omitempty"`
+	Named      map[string]any `json:",omitempty"`
+}
+
+func (a *RawArgs) UnmarshalYAML(unmarshal func(any) error) error {
+	var positional []any
+	if err := unmarshal(&positional); err == nil {
+		a.Positional = positional
+		return nil
+	}
+	var named map[string]any
+	if err := unmarshal(&named); err == nil {
+		a.Named = named
+		return nil
+	}
+	// A single value is a list of one
+	var value any
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	a.Positional = []any{value}
+	return nil
+}
+
+// withOverride returns the args with those of an override applied. Named args are merged so
+// an override can change a single arg, anything else replaces the args.
+func (a RawArgs) withOverride(override RawArgs) RawArgs {
+	if len(a.Named) == 0 || len(override.Named) == 0 {
+		return override
+	}
+	merged := RawArgs{Named: make(map[string]any, len(a.Named)+len(override.Named))}
+	for name, value := range a.Named {
+		merged.Named[name] = value
+	}
+	for name, value := range override.Named {
+		merged.Named[name] = value
+	}
+	return merged
+}
+
 func (f RawFn) GetMetadataHash() (string, error) {
 	hash, ok := f.Metadata["sha256"]
 
@@ -194,9 +387,55 @@ type RawRule struct {
 }
 
 type RawConfig struct {
-	Version  string
-	Includes []IncludeRaw
-	Rules    []RawRule
+	Version   string
+	Includes  []IncludeRaw
+	Rules     []RawRule
+	Overrides []RawOverride
+	// RequireIgnoreReason reports ignore directives without a reason after --
+	RequireIgnoreReason bool `yaml:"require_ignore_reason"`
+}
+
+// RawOverride adjusts rules for the files matching any of its globs
+type RawOverride struct {
+	Files []string
+	Rules map[string]RawRuleOverride
+}
+
+// RawRuleOverride is decoded from `off`, a severity, or a mapping of severity and args
+type RawRuleOverride struct {
+	Off      bool
+	Severity string
+	// Args replace the rule's fn args when not nil, named args are merged into named args
+	Args *RawArgs
+}
+
+func (o *RawRuleOverride) UnmarshalYAML(unmarshal func(any) error) error {
+	// yaml.v2 decodes an unquoted off as false
+	var enabled bool
+	if err := unmarshal(&enabled); err == nil {
+		if enabled {
+			return fmt.Errorf("rule override must be off, a severity or a mapping of severity and args")
+		}
+		o.Off = true
+		return nil
+	}
+	var value string
+	if err := unmarshal(&value); err == nil {
+		o.Off = value == "off"
+		if !o.Off {
+			o.Severity = value
+		}
+		return nil
+	}
+	var mapping struct {
+		Severity string
+		Args     *RawArgs
+	}
+	if err := unmarshal(&mapping); err != nil {
+		return err
+	}
+	o.Severity, o.Args = mapping.Severity, mapping.Args
+	return nil
 }
 
 type IncludeRaw struct {
@@ -208,4 +447,37 @@ type IncludeRaw struct {
 type ConfigFile struct {
 	Rules   []Rule
 	Version string
+	// Sources are the absolute paths of the local files the config was read from, the config
+	// itself followed by its includes
+	Sources []string
+	// RequireIgnoreReason reports ignore directives without a reason after --
+	RequireIgnoreReason bool
+	// Overrides are applied in order to the files they match, so later overrides win. Those of
+	// includes come before the overrides of the config including them.
+	Overrides []Override
+	// literals matches the text of every literal contains rule in one pass, nil when there
+	// aren't enough of them to merge
+	literals *literalMatcher
+}
+
+// Override adjusts rules for the files matching any of its globs
+type Override struct {
+	// Files are the globs as declared, relative to base
+	Files []string
+	// base is the absolute directory of the declaring config, or the working directory for
+	// remote configs
+	base     string
+	patterns []*regexp.Regexp
+	Rules    map[string]RuleOverride
+}
+
+// RuleOverride turns a rule off, or replaces its severity or function for matching files
+type RuleOverride struct {
+	Off bool
+	// Severity replaces the rule's severity unless it is unknownSeverity
+	Severity SeverityLevel
+	// Fn is the rule's function rebuilt with the override's args, nil to keep the rule's
+	Fn      RuleFunc
+	source  RawFn
+	literal string
 }